@@ -170,12 +170,14 @@ async function uploadVideoFile(videoID) {
       },
       body: formData,
     });
+    const job = await res.json();
     if (!res.ok) {
-      const data = await res.json();
-      throw new Error(`Failed to upload video file. Error: ${data.error}`);
+      throw new Error(`Failed to upload video file. Error: ${job.error}`);
     }
 
-    console.log('Video uploaded!');
+    console.log('Video uploaded, processing...');
+    await waitForJob(job.id);
+    console.log('Video processed!');
     await getVideo(videoID);
   } catch (error) {
     alert(`Error: ${error.message}`);
@@ -184,11 +186,38 @@ async function uploadVideoFile(videoID) {
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+async function waitForJob(jobID) {
+  while (true) {
+    const res = await fetch(`/api/jobs/${jobID}`, {
+      method: 'GET',
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+    const job = await res.json();
+    if (!res.ok) {
+      throw new Error(`Failed to get processing status. Error: ${job.error}`);
+    }
+    if (job.status === 'succeeded') {
+      return job;
+    }
+    if (job.status === 'dead') {
+      throw new Error(`Failed to process video. Error: ${job.error}`);
+    }
+    await new Promise((resolve) => setTimeout(resolve, 2000));
+  }
+}
+
 const videoStateHandler = createVideoStateHandler();
 
-async function getVideos() {
+async function getVideos(cursor = '') {
   try {
-    const res = await fetch('/api/videos', {
+    const params = new URLSearchParams({ limit: '50' });
+    if (cursor) {
+      params.set('cursor', cursor);
+    }
+    const url = `/api/videos?${params}`;
+    const res = await fetch(url, {
       method: 'GET',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -201,13 +230,25 @@ async function getVideos() {
 
     const videos = await res.json();
     const videoList = document.getElementById('video-list');
-    videoList.innerHTML = '';
+    if (!cursor) {
+      videoList.innerHTML = '';
+    }
+    document.getElementById('video-list-more')?.remove();
     for (const video of videos) {
       const listItem = document.createElement('li');
       listItem.textContent = video.title;
       listItem.onclick = () => videoStateHandler(video.id);
       videoList.appendChild(listItem);
     }
+
+    const nextCursor = res.headers.get('X-Next-Cursor');
+    if (nextCursor) {
+      const more = document.createElement('li');
+      more.id = 'video-list-more';
+      more.textContent = 'Load more…';
+      more.onclick = () => getVideos(nextCursor);
+      videoList.appendChild(more);
+    }
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	errInvalidCredentials  = errors.New("invalid or expired credentials")
+	errMalformedAuthHeader = errors.New("malformed authorization header")
+)
+
+// principal is who a request acts for.
+type principal struct {
+	User database.User
+	// APIKeyID is set when the request used an API key, which limits it to
+	// Scopes. Access tokens carry every scope, and SessionID instead.
+	APIKeyID  uuid.UUID
+	Scopes    []auth.Scope
+	SessionID uuid.UUID
+}
+
+func (p principal) hasScope(scope auth.Scope) bool {
+	return p.APIKeyID == uuid.Nil || slices.Contains(p.Scopes, scope)
+}
+
+// resolvePrincipal identifies the caller from either an
+// `Authorization: Bearer <jwt>` or an `Authorization: ApiKey <key>` header.
+// API keys are also accepted as bearer tokens for clients that only speak
+// Bearer. Disabled users are refused whichever they use.
+func (cfg *apiConfig) resolvePrincipal(r *http.Request) (principal, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return principal{}, auth.ErrNoAuthHeaderIncluded
+	}
+	scheme, credential, ok := strings.Cut(header, " ")
+	if !ok || credential == "" {
+		return principal{}, errMalformedAuthHeader
+	}
+
+	var p principal
+	var userID uuid.UUID
+	switch {
+	case scheme == "ApiKey" || scheme == "Bearer" && auth.IsAPIKey(credential):
+		key, err := cfg.db.GetActiveAPIKeyByHash(auth.HashAPIKey(credential))
+		if err != nil {
+			return principal{}, err
+		}
+		if key.ID == uuid.Nil {
+			return principal{}, errInvalidCredentials
+		}
+		p.APIKeyID = key.ID
+		for _, s := range key.Scopes {
+			p.Scopes = append(p.Scopes, auth.Scope(s))
+		}
+		userID = key.UserID
+	case scheme == "Bearer":
+		var err error
+		userID, p.SessionID, err = auth.ValidateJWT(credential, cfg.jwtSecret)
+		if err != nil {
+			return principal{}, fmt.Errorf("%w: %v", errInvalidCredentials, err)
+		}
+		// Access tokens die with their session, even before they expire
+		active, err := cfg.db.TouchSession(userID, p.SessionID)
+		if err != nil {
+			return principal{}, err
+		}
+		if !active {
+			return principal{}, fmt.Errorf("%w: session has ended", errInvalidCredentials)
+		}
+	default:
+		return principal{}, errMalformedAuthHeader
+	}
+
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		return principal{}, err
+	}
+	if user == nil || user.DisabledAt != nil {
+		return principal{}, errInvalidCredentials
+	}
+	p.User = *user
+	return p, nil
+}
+
+// access is what a route asks of its caller, declared where the route is
+// registered and checked by cfg.require before its handler runs.
+type access struct {
+	// authenticated turns away anonymous callers. Without it, callers whose
+	// credentials don't check out are treated as anonymous.
+	authenticated bool
+	// scope is what an API key must be granted, and session refuses API keys
+	// altogether.
+	scope   auth.Scope
+	session bool
+	// videoOwner requires the caller to own the {videoID} video, which is
+	// then in the request context.
+	videoOwner bool
+	permission auth.Permission
+}
+
+// anonymous lets anyone in, identifying callers who send credentials so
+// private content can be shown to its owner.
+var anonymous = access{scope: auth.ScopeVideosRead}
+
+func authenticated(scope auth.Scope) access {
+	return access{authenticated: true, scope: scope}
+}
+
+// sessionOnly needs a JWT from logging in. Managing the account itself, API
+// keys included, isn't something API keys may do.
+var sessionOnly = access{authenticated: true, session: true}
+
+var ownerOfVideo = access{authenticated: true, scope: auth.ScopeVideosWrite, videoOwner: true}
+
+// admin needs a JWT from a user whose role grants perm.
+func admin(perm auth.Permission) access {
+	return access{authenticated: true, session: true, permission: perm}
+}
+
+type contextKey int
+
+const (
+	principalContextKey contextKey = iota
+	videoContextKey
+)
+
+// require wraps next so it only runs for callers a allows, with the caller
+// in the request context.
+func (cfg *apiConfig) require(a access, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := cfg.resolvePrincipal(r)
+		credentialsErr := errors.Is(err, auth.ErrNoAuthHeaderIncluded) ||
+			errors.Is(err, errInvalidCredentials) ||
+			errors.Is(err, errMalformedAuthHeader)
+		if err != nil && !credentialsErr {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check credentials", err)
+			return
+		}
+
+		if !a.authenticated {
+			if err == nil && p.hasScope(a.scope) {
+				r = r.WithContext(context.WithValue(r.Context(), principalContextKey, p))
+			}
+			next(w, r)
+			return
+		}
+
+		switch {
+		case errors.Is(err, auth.ErrNoAuthHeaderIncluded):
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT or API key", err)
+			return
+		case errors.Is(err, errMalformedAuthHeader):
+			respondWithError(w, http.StatusUnauthorized, "Malformed authorization header", err)
+			return
+		case err != nil:
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate credentials", err)
+			return
+		}
+		if a.session && p.APIKeyID != uuid.Nil {
+			respondWithError(w, http.StatusForbidden, "API keys can't be used for this", nil)
+			return
+		}
+		if a.scope != "" && !p.hasScope(a.scope) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("API key lacks the %s scope", a.scope), nil)
+			return
+		}
+		if a.permission != "" && !auth.Role(p.User.Role).Can(a.permission) {
+			respondWithError(w, http.StatusForbidden, "You don't have permission to do this", nil)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey, p)
+		if a.videoOwner {
+			video, ok := cfg.ownedVideoFromPath(w, r, p.User.ID)
+			if !ok {
+				return
+			}
+			ctx = context.WithValue(ctx, videoContextKey, video)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// ownedVideoFromPath loads the {videoID} video, writing the error response
+// itself unless it exists and belongs to userID.
+func (cfg *apiConfig) ownedVideoFromPath(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You don't own this video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// principalFromContext returns who the request acts for, if anyone.
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalContextKey).(principal)
+	return p, ok
+}
+
+// userIDFromContext returns the caller's user ID, or uuid.Nil for anonymous
+// requests.
+func userIDFromContext(ctx context.Context) uuid.UUID {
+	p, _ := principalFromContext(ctx)
+	return p.User.ID
+}
+
+// videoFromContext returns the video an ownerOfVideo route was called for.
+func videoFromContext(ctx context.Context) database.Video {
+	video, _ := ctx.Value(videoContextKey).(database.Video)
+	return video
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// commands are admin tasks run as `tubely <command> [flags]` with the same
+// environment as the server.
+func (cfg *apiConfig) commands() map[string]func(ctx context.Context, args []string) error {
+	return map[string]func(ctx context.Context, args []string) error{
+		"gc":       cfg.runGC,
+		"set-role": cfg.runSetRole,
+	}
+}
+
+func (cfg *apiConfig) runCommand(ctx context.Context, name string, args []string) error {
+	commands := cfg.commands()
+	command, ok := commands[name]
+	if !ok {
+		names := []string{"migrate"}
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "usage: %s [%s] [flags]\n", os.Args[0], strings.Join(names, "|"))
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return command(ctx, args)
+}
+
+// runMigrate handles `tubely migrate up|down|to <version>`.
+func runMigrate(db database.Client, args []string) error {
+	usage := fmt.Errorf("usage: %s migrate up|down|to <version>", os.Args[0])
+	if len(args) == 0 {
+		return usage
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = db.MigrateUp()
+	case "down":
+		err = db.MigrateDown()
+	case "to":
+		if len(args) != 2 {
+			return usage
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return usage
+		}
+		err = db.MigrateTo(version)
+	default:
+		return usage
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latest, err := db.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema at version %d of %d\n", version, latest)
+	return nil
+}
+
+// runSetRole handles `tubely set-role -email <email> -role <role>`, which is
+// how the first admin is made.
+func (cfg *apiConfig) runSetRole(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("set-role", flag.ExitOnError)
+	email := flags.String("email", "", "email of an existing user")
+	role := flags.String("role", string(auth.RoleAdmin), "user, moderator or admin")
+	flags.Parse(args)
+
+	if *email == "" || !auth.Role(*role).Valid() {
+		flags.Usage()
+		return errors.New("an email and a valid role are required")
+	}
+	user, err := cfg.db.GetUserByEmail(*email)
+	if err != nil {
+		return err
+	}
+	if user.ID == uuid.Nil {
+		return fmt.Errorf("no user with email %q; sign up first", *email)
+	}
+	_, err = cfg.db.SetUserRole(user.ID, *role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s\n", user.Email, *role)
+	return nil
+}
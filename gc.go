@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+const (
+	tombstoneSweepInterval = 30 * time.Second
+	tombstoneBatchSize     = 100
+	// gcDefaultMinAge keeps gc away from objects that jobs and uploads are
+	// still writing and haven't linked to a video yet.
+	gcDefaultMinAge = 24 * time.Hour
+)
+
+// tombstoneStore maps a tombstone's store name onto the backend holding it.
+func (cfg *apiConfig) tombstoneStore(name string) (storage.Storage, error) {
+	switch name {
+	case database.TombstoneStoreVideo:
+		return cfg.videoStorage, nil
+	case database.TombstoneStoreThumbnail:
+		return cfg.thumbnailStorage, nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", name)
+	}
+}
+
+// deleteStoredObjects deletes key, or every object below it when prefix is
+// set. Objects that are already gone count as deleted.
+func (cfg *apiConfig) deleteStoredObjects(ctx context.Context, st storage.Storage, key string, prefix bool) error {
+	keys := []string{key}
+	if prefix {
+		objects, err := st.List(ctx, key)
+		if err != nil {
+			return err
+		}
+		keys = keys[:0]
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+	}
+	for _, k := range keys {
+		err := st.Delete(ctx, k)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweepTombstones deletes the objects behind due tombstones, backing off
+// between attempts when deletes fail.
+func (cfg *apiConfig) sweepTombstones(ctx context.Context) {
+	ticker := time.NewTicker(tombstoneSweepInterval)
+	defer ticker.Stop()
+	for {
+		tombstones, err := cfg.db.GetDueTombstones(tombstoneBatchSize)
+		if err != nil {
+			log.Printf("couldn't list tombstones: %v", err)
+		}
+		for _, t := range tombstones {
+			err := cfg.purgeTombstone(ctx, t)
+			if err == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("couldn't delete %s object %s: %v", t.Store, t.Key, err)
+			err = cfg.db.RetryTombstone(t.ID, err.Error(), time.Now().Add(jobBackoff(t.Attempts+1)))
+			if err != nil {
+				log.Printf("couldn't reschedule tombstone %d: %v", t.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) purgeTombstone(ctx context.Context, t database.Tombstone) error {
+	st, err := cfg.tombstoneStore(t.Store)
+	if err != nil {
+		return err
+	}
+	err = cfg.deleteStoredObjects(ctx, st, t.Key, t.Prefix)
+	if err != nil {
+		return err
+	}
+	return cfg.db.DeleteTombstone(t.ID)
+}
+
+// storageKeyFromURL recovers the key behind a URL built by st. Rows written
+// before keys were stored only have URLs.
+func storageKeyFromURL(st storage.Storage, u *string) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+	key, ok := strings.CutPrefix(*u, st.URL(""))
+	return key, ok && key != ""
+}
+
+// videoReferences collects the URLs and URL prefixes of the objects videos
+// still point at. URLs identify an object whichever store lists it: on S3 both
+// stores share a bucket, and on disk the video root sits inside the thumbnail
+// root.
+type videoReferences struct {
+	urls     map[string]bool
+	prefixes []string
+}
+
+func (refs *videoReferences) add(st storage.Storage, key string) {
+	refs.urls[st.URL(key)] = true
+}
+
+func (refs *videoReferences) addPrefix(st storage.Storage, prefix string) {
+	refs.prefixes = append(refs.prefixes, st.URL(prefix))
+}
+
+func (refs *videoReferences) has(u string) bool {
+	if refs.urls[u] {
+		return true
+	}
+	for _, p := range refs.prefixes {
+		if strings.HasPrefix(u, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *apiConfig) collectVideoReferences() (*videoReferences, error) {
+	refs := &videoReferences{urls: map[string]bool{}}
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return refs, err
+	}
+	for _, v := range videos {
+		if v.VideoKey != nil {
+			refs.add(cfg.videoStorage, *v.VideoKey)
+		} else if key, ok := storageKeyFromURL(cfg.videoStorage, v.VideoURL); ok {
+			refs.add(cfg.videoStorage, key)
+		}
+
+		hlsKey, ok := "", v.HLSKey != nil
+		if ok {
+			hlsKey = *v.HLSKey
+		} else {
+			hlsKey, ok = storageKeyFromURL(cfg.videoStorage, v.HLSURL)
+		}
+		if ok {
+			refs.addPrefix(cfg.videoStorage, path.Dir(hlsKey)+"/")
+		}
+
+		if v.ThumbnailKey != nil && path.Dir(*v.ThumbnailKey) != "." {
+			refs.addPrefix(cfg.thumbnailStorage, path.Dir(*v.ThumbnailKey)+"/")
+		} else if v.ThumbnailKey != nil {
+			refs.add(cfg.thumbnailStorage, *v.ThumbnailKey)
+		} else if key, ok := storageKeyFromURL(cfg.thumbnailStorage, v.ThumbnailURL); ok {
+			refs.add(cfg.thumbnailStorage, key)
+		}
+	}
+	return refs, nil
+}
+
+// runGC lists objects in the video and thumbnail stores that no video
+// references, deleting them when asked to.
+func (cfg *apiConfig) runGC(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	del := flags.Bool("delete", false, "delete unreferenced objects instead of only listing them")
+	minAge := flags.Duration("min-age", gcDefaultMinAge, "ignore objects modified more recently than this")
+	flags.Parse(args)
+
+	refs, err := cfg.collectVideoReferences()
+	if err != nil {
+		return fmt.Errorf("couldn't load videos: %w", err)
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer out.Flush()
+	fmt.Fprintln(out, "STORE\tKEY\tSIZE\tLAST MODIFIED\tACTION")
+
+	cutoff := time.Now().Add(-*minAge)
+	listed := map[string]bool{}
+	var count, bytes int64
+	var failed int
+	for _, store := range []string{database.TombstoneStoreVideo, database.TombstoneStoreThumbnail} {
+		st, err := cfg.tombstoneStore(store)
+		if err != nil {
+			return err
+		}
+		objects, err := st.List(ctx, "")
+		if err != nil {
+			return fmt.Errorf("couldn't list %s objects: %w", store, err)
+		}
+		for _, obj := range objects {
+			// Objects both stores can see are only considered once
+			u := st.URL(obj.Key)
+			if listed[u] {
+				continue
+			}
+			listed[u] = true
+			if refs.has(u) || obj.LastModified.After(cutoff) {
+				continue
+			}
+
+			action := "unreferenced"
+			if *del {
+				action = "deleted"
+				err := st.Delete(ctx, obj.Key)
+				if err != nil && !errors.Is(err, storage.ErrNotFound) {
+					action = fmt.Sprintf("failed: %v", err)
+					failed++
+				}
+			}
+			count++
+			bytes += obj.Size
+			fmt.Fprintf(out, "%s\t%s\t%d\t%s\t%s\n", store, obj.Key, obj.Size, obj.LastModified.UTC().Format(time.RFC3339), action)
+		}
+	}
+	out.Flush()
+
+	fmt.Printf("%d unreferenced objects, %d bytes\n", count, bytes)
+	if failed > 0 {
+		return fmt.Errorf("%d deletes failed", failed)
+	}
+	return nil
+}
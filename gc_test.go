@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func TestGCWithNestedDiskStores(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+	root := t.TempDir()
+	var err error
+	cfg.thumbnailStorage, err = storage.NewDiskStorage(root, "http://localhost/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.videoStorage, err = storage.NewDiskStorage(filepath.Join(root, "videos"), "http://localhost/assets/videos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := cfg.db.CreateUser(database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "Title", Visibility: database.VisibilityPublic, UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestObject(t, cfg.videoStorage, "landscape/abc.mp4", "mp4")
+	putTestObject(t, cfg.videoStorage, "landscape/orphan.mp4", "mp4")
+	putTestObject(t, cfg.thumbnailStorage, "thumbs/640.jpeg", "thumbnail")
+	putTestObject(t, cfg.thumbnailStorage, "orphan/640.jpeg", "thumbnail")
+	videoKey, thumbnailKey := "landscape/abc.mp4", "thumbs/640.jpeg"
+	video.VideoKey, video.ThumbnailKey = &videoKey, &thumbnailKey
+	cfg.applyVideoVisibility(&video)
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cfg.runGC(ctx, []string{"-delete", "-min-age", "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The thumbnail store sees the video files too, but they're still in use
+	for _, obj := range []struct {
+		st   storage.Storage
+		key  string
+		kept bool
+	}{
+		{cfg.videoStorage, "landscape/abc.mp4", true},
+		{cfg.videoStorage, "landscape/orphan.mp4", false},
+		{cfg.thumbnailStorage, "thumbs/640.jpeg", true},
+		{cfg.thumbnailStorage, "orphan/640.jpeg", false},
+	} {
+		_, err := obj.st.Stat(ctx, obj.key)
+		if obj.kept && err != nil {
+			t.Errorf("%s was deleted: %v", obj.key, err)
+		}
+		if !obj.kept && !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s wasn't deleted: %v", obj.key, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerAdminUsersList(w http.ResponseWriter, r *http.Request) {
+
+	users, err := cfg.db.GetUsers()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get users", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+func (cfg *apiConfig) handlerAdminUserDisable(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserDisabled(w, r, true)
+}
+
+func (cfg *apiConfig) handlerAdminUserEnable(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserDisabled(w, r, false)
+}
+
+func (cfg *apiConfig) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	adminID := userIDFromContext(r.Context())
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	// Otherwise the last admin could lock everyone out
+	if userID == adminID {
+		respondWithError(w, http.StatusBadRequest, "You can't disable yourself", nil)
+		return
+	}
+
+	found, err := cfg.db.SetUserDisabled(userID, disabled)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user", nil)
+		return
+	}
+	cfg.respondWithUser(w, userID)
+}
+
+func (cfg *apiConfig) handlerAdminUserRoleUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role auth.Role `json:"role"`
+	}
+
+	adminID := userIDFromContext(r.Context())
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !params.Role.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Role must be user, moderator or admin", nil)
+		return
+	}
+	if userID == adminID && params.Role != auth.RoleAdmin {
+		respondWithError(w, http.StatusBadRequest, "You can't change your own role", nil)
+		return
+	}
+
+	found, err := cfg.db.SetUserRole(userID, string(params.Role))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user", nil)
+		return
+	}
+	cfg.respondWithUser(w, userID)
+}
+
+func (cfg *apiConfig) respondWithUser(w http.ResponseWriter, userID uuid.UUID) {
+	user, err := cfg.db.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find user", nil)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// handlerAdminVideoGet returns any video whatever its visibility, with
+// short-lived URLs for private ones.
+func (cfg *apiConfig) handlerAdminVideoGet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.videoFromPath(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, cfg.resolveVideoURLs(r.Context(), video))
+}
+
+// handlerAdminVideoDelete deletes a video regardless of its owner.
+func (cfg *apiConfig) handlerAdminVideoDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.videoFromPath(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.deleteVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) videoFromPath(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
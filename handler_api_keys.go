@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefixLength is how much of a key is kept in the clear to tell keys
+// apart: the "tubely_" marker plus a few random characters.
+const apiKeyPrefixLength = len(auth.APIKeyPrefix) + 6
+
+// handlerAPIKeyCreate makes a new API key for the caller. The key itself is
+// only ever in this response.
+func (cfg *apiConfig) handlerAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name      string       `json:"name"`
+		Scopes    []auth.Scope `json:"scopes"`
+		ExpiresAt *time.Time   `json:"expires_at"`
+	}
+	type response struct {
+		database.APIKey
+		Key string `json:"key"`
+	}
+
+	userID := userIDFromContext(r.Context())
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required", nil)
+		return
+	}
+	if len(params.Scopes) == 0 {
+		params.Scopes = auth.AllScopes
+	}
+	scopes := []string{}
+	for _, s := range params.Scopes {
+		if !s.Valid() {
+			respondWithError(w, http.StatusBadRequest, "Scopes must be videos:read or videos:write", nil)
+			return
+		}
+		scopes = append(scopes, string(s))
+	}
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "Expiry must be in the future", nil)
+		return
+	}
+
+	key, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create API key", err)
+		return
+	}
+	apiKey, err := cfg.db.CreateAPIKey(database.CreateAPIKeyParams{
+		UserID:    userID,
+		Name:      params.Name,
+		KeyHash:   auth.HashAPIKey(key),
+		Prefix:    key[:apiKeyPrefixLength],
+		Scopes:    scopes,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create API key", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, response{APIKey: apiKey, Key: key})
+}
+
+func (cfg *apiConfig) handlerAPIKeysRetrieve(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(r.Context())
+
+	keys, err := cfg.db.GetAPIKeys(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get API keys", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+func (cfg *apiConfig) handlerAPIKeyUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+
+	userID := userIDFromContext(r.Context())
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required", nil)
+		return
+	}
+
+	found, err := cfg.db.RenameAPIKey(userID, keyID, params.Name)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update API key", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Couldn't find API key", nil)
+		return
+	}
+
+	key, err := cfg.db.GetAPIKey(userID, keyID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get API key", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, key)
+}
+
+// handlerAPIKeyDelete revokes one of the caller's API keys.
+func (cfg *apiConfig) handlerAPIKeyDelete(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(r.Context())
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid API key ID", err)
+		return
+	}
+
+	found, err := cfg.db.RevokeAPIKey(userID, keyID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke API key", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Couldn't find API key", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
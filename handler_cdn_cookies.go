@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
+	"github.com/google/uuid"
+)
+
+// handlerCDNCookies sets CloudFront signed cookies covering a video's file and
+// HLS tree, so players can fetch the playlist and every segment through the
+// distribution. Access follows the same rules as handlerVideoGet.
+func (cfg *apiConfig) handlerCDNCookies(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		VideoURL  *string   `json:"video_url"`
+		HLSURL    *string   `json:"hls_url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	if cfg.cdnSigner == nil {
+		respondWithError(w, http.StatusNotImplemented, "CloudFront signing isn't configured", nil)
+		return
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !cfg.canViewVideo(r, video) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+	if video.VideoKey == nil {
+		respondWithError(w, http.StatusConflict, "Video hasn't been processed yet", nil)
+		return
+	}
+
+	// The MP4 and its HLS tree share the key minus its extension, so a single
+	// wildcard covers both
+	stem := strings.TrimSuffix(*video.VideoKey, path.Ext(*video.VideoKey))
+	resource := cfg.videoStorage.URL(stem) + "*"
+	expiresAt := time.Now().UTC().Add(cfg.videoURLExpiry)
+
+	cookies, err := cfg.cdnSigner.SignCookies(cdn.Policy{Resource: resource, Expires: expiresAt})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign cookies", err)
+		return
+	}
+	for _, c := range cookies {
+		http.SetCookie(w, c)
+	}
+
+	videoURL := cfg.videoStorage.URL(*video.VideoKey)
+	resp := response{VideoURL: &videoURL, ExpiresAt: expiresAt}
+	if video.HLSKey != nil {
+		hlsURL := cfg.videoStorage.URL(*video.HLSKey)
+		resp.HLSURL = &hlsURL
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type playlistWithItems struct {
+	database.Playlist
+	Items []database.PlaylistItem `json:"items"`
+}
+
+// playlistDetails loads a playlist's items for the response, leaving out
+// videos the requester isn't allowed to see.
+func (cfg *apiConfig) playlistDetails(r *http.Request, playlist database.Playlist) (playlistWithItems, error) {
+	items, err := cfg.db.GetPlaylistItems(playlist.ID)
+	if err != nil {
+		return playlistWithItems{}, err
+	}
+	visible := items[:0]
+	for _, item := range items {
+		if !cfg.canViewVideo(r, item.Video) {
+			continue
+		}
+		item.Video = cfg.resolveVideoURLs(r.Context(), item.Video)
+		visible = append(visible, item)
+	}
+	return playlistWithItems{Playlist: playlist, Items: visible}, nil
+}
+
+func (cfg *apiConfig) respondWithPlaylist(w http.ResponseWriter, r *http.Request, code int, playlist database.Playlist) {
+	details, err := cfg.playlistDetails(r, playlist)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist items", err)
+		return
+	}
+	respondWithJSON(w, code, details)
+}
+
+func (cfg *apiConfig) handlerPlaylistCreate(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(r.Context())
+
+	params := database.CreatePlaylistParams{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.UserID = userID
+	if params.Title == "" {
+		respondWithError(w, http.StatusBadRequest, "Title is required", nil)
+		return
+	}
+	if params.Visibility != "" && !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Visibility must be public, unlisted or private", nil)
+		return
+	}
+
+	playlist, err := cfg.db.CreatePlaylist(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create playlist", err)
+		return
+	}
+	cfg.respondWithPlaylist(w, r, http.StatusCreated, playlist)
+}
+
+// handlerPlaylistsRetrieve lists the caller's playlists without their items.
+func (cfg *apiConfig) handlerPlaylistsRetrieve(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(r.Context())
+
+	playlists, err := cfg.db.GetPlaylists(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlists", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+// handlerPlaylistGet follows the same visibility rules as handlerVideoGet.
+func (cfg *apiConfig) handlerPlaylistGet(w http.ResponseWriter, r *http.Request) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return
+	}
+
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	if playlist.ID == uuid.Nil || !cfg.canViewPlaylist(r, playlist) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", nil)
+		return
+	}
+	cfg.respondWithPlaylist(w, r, http.StatusOK, playlist)
+}
+
+func (cfg *apiConfig) canViewPlaylist(r *http.Request, playlist database.Playlist) bool {
+	if playlist.Visibility != database.VisibilityPrivate {
+		return true
+	}
+	return userIDFromContext(r.Context()) == playlist.UserID
+}
+
+func (cfg *apiConfig) handlerPlaylistUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string              `json:"title"`
+		Description *string              `json:"description"`
+		Visibility  *database.Visibility `json:"visibility"`
+	}
+
+	playlist, ok := cfg.ownedPlaylistFromPath(w, r, "You can't change this playlist")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Title != nil {
+		if *params.Title == "" {
+			respondWithError(w, http.StatusBadRequest, "Title is required", nil)
+			return
+		}
+		playlist.Title = *params.Title
+	}
+	if params.Description != nil {
+		playlist.Description = *params.Description
+	}
+	if params.Visibility != nil {
+		if !params.Visibility.Valid() {
+			respondWithError(w, http.StatusBadRequest, "Visibility must be public, unlisted or private", nil)
+			return
+		}
+		playlist.Visibility = *params.Visibility
+	}
+
+	err = cfg.db.UpdatePlaylist(playlist)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update playlist", err)
+		return
+	}
+	cfg.respondWithUpdatedPlaylist(w, r, playlist.ID)
+}
+
+func (cfg *apiConfig) handlerPlaylistDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.ownedPlaylistFromPath(w, r, "You can't delete this playlist")
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeletePlaylist(playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete playlist", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistItemAdd inserts a video the caller can see at an optional
+// position, appending it by default.
+func (cfg *apiConfig) handlerPlaylistItemAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID  uuid.UUID `json:"video_id"`
+		Position *int      `json:"position"`
+	}
+
+	playlist, ok := cfg.ownedPlaylistFromPath(w, r, "You can't change this playlist")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !cfg.canViewVideo(r, video) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	err = cfg.db.AddPlaylistItem(playlist.ID, video.ID, params.Position)
+	if err != nil {
+		respondWithPlaylistItemError(w, err)
+		return
+	}
+	cfg.respondWithUpdatedPlaylist(w, r, playlist.ID)
+}
+
+func (cfg *apiConfig) handlerPlaylistItemDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.ownedPlaylistFromPath(w, r, "You can't change this playlist")
+	if !ok {
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	err = cfg.db.RemovePlaylistItem(playlist.ID, videoID)
+	if err != nil {
+		respondWithPlaylistItemError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPlaylistItemMove moves one video to a new position.
+func (cfg *apiConfig) handlerPlaylistItemMove(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Position *int `json:"position"`
+	}
+
+	playlist, ok := cfg.ownedPlaylistFromPath(w, r, "You can't change this playlist")
+	if !ok {
+		return
+	}
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	params := parameters{}
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Position == nil {
+		respondWithError(w, http.StatusBadRequest, "Position is required", nil)
+		return
+	}
+
+	err = cfg.db.MovePlaylistItem(playlist.ID, videoID, *params.Position)
+	if err != nil {
+		respondWithPlaylistItemError(w, err)
+		return
+	}
+	cfg.respondWithUpdatedPlaylist(w, r, playlist.ID)
+}
+
+// handlerPlaylistReorder replaces the whole order at once. The body must list
+// every video in the playlist exactly once.
+func (cfg *apiConfig) handlerPlaylistReorder(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoIDs []uuid.UUID `json:"video_ids"`
+	}
+
+	playlist, ok := cfg.ownedPlaylistFromPath(w, r, "You can't change this playlist")
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = cfg.db.ReorderPlaylist(playlist.ID, params.VideoIDs)
+	if err != nil {
+		respondWithPlaylistItemError(w, err)
+		return
+	}
+	cfg.respondWithUpdatedPlaylist(w, r, playlist.ID)
+}
+
+func respondWithPlaylistItemError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrPlaylistItemExists):
+		respondWithError(w, http.StatusConflict, err.Error(), err)
+	case errors.Is(err, database.ErrPlaylistItemNotFound):
+		respondWithError(w, http.StatusNotFound, err.Error(), err)
+	case errors.Is(err, database.ErrInvalidPosition), errors.Is(err, database.ErrReorderMismatch):
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+	default:
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update playlist", err)
+	}
+}
+
+// respondWithUpdatedPlaylist reloads a playlist after a change so the
+// response carries the new updated_at and item count.
+func (cfg *apiConfig) respondWithUpdatedPlaylist(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	playlist, err := cfg.db.GetPlaylist(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	cfg.respondWithPlaylist(w, r, http.StatusOK, playlist)
+}
+
+// ownedPlaylistFromPath loads the {playlistID} playlist for a request that
+// must come from its owner, writing the error response itself when it can't.
+func (cfg *apiConfig) ownedPlaylistFromPath(w http.ResponseWriter, r *http.Request, forbidden string) (database.Playlist, bool) {
+	playlistID, err := uuid.Parse(r.PathValue("playlistID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, false
+	}
+
+	userID := userIDFromContext(r.Context())
+
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return database.Playlist{}, false
+	}
+	if playlist.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get playlist", nil)
+		return database.Playlist{}, false
+	}
+	if playlist.UserID != userID {
+		respondWithError(w, http.StatusForbidden, forbidden, nil)
+		return database.Playlist{}, false
+	}
+	return playlist, true
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
+// refreshTokenExpiry is how long a refresh token lasts. Each use replaces it
+// with a new one, so sessions in use don't run out.
+const refreshTokenExpiry = 60 * 24 * time.Hour
+
+// handlerRefresh trades a refresh token for a new access token and a new
+// refresh token. The old refresh token stops working; presenting it again
+// logs out every token descended from the same login.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -18,14 +28,44 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+	userAgent, ipAddress := clientInfo(r)
+	rotated, err := cfg.db.RotateRefreshToken(refreshToken, database.CreateRefreshTokenParams{
+		Token:     newRefreshToken,
+		ExpiresAt: time.Now().UTC().Add(refreshTokenExpiry),
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+	})
+	if errors.Is(err, database.ErrRefreshTokenReused) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was already used", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
+		return
+	}
+	if rotated.Token == "" {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUser(rotated.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user for refresh token", err)
+		return
+	}
+	if user == nil || user.DisabledAt != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", nil)
 		return
 	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
+		rotated.FamilyID,
 		cfg.jwtSecret,
 		time.Hour,
 	)
@@ -35,7 +75,8 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 }
 
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxUserAgentLength keeps clients from storing arbitrary amounts of text
+// with their session.
+const maxUserAgentLength = 256
+
+// clientInfo describes where a request came from, for the session it logs in
+// or refreshes.
+func clientInfo(r *http.Request) (userAgent, ipAddress string) {
+	userAgent = r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	ipAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ipAddress = r.RemoteAddr
+	}
+	return userAgent, ipAddress
+}
+
+// handlerSessionsRetrieve lists where the caller is logged in, marking the
+// session the request was made from.
+func (cfg *apiConfig) handlerSessionsRetrieve(w http.ResponseWriter, r *http.Request) {
+	type session struct {
+		database.Session
+		Current bool `json:"current"`
+	}
+
+	p, _ := principalFromContext(r.Context())
+	sessions, err := cfg.db.GetSessions(p.User.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+
+	resp := make([]session, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, session{Session: s, Current: s.ID == p.SessionID})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerSessionDelete logs one of the caller's sessions out, the current one
+// included. Its access tokens stop working straight away.
+func (cfg *apiConfig) handlerSessionDelete(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	found, err := cfg.db.RevokeSession(userIDFromContext(r.Context()), sessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Couldn't find session", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerSessionsRevokeOthers logs the caller out everywhere but the session
+// the request was made from.
+func (cfg *apiConfig) handlerSessionsRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	p, _ := principalFromContext(r.Context())
+	err := cfg.db.RevokeOtherSessions(p.User.ID, p.SessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
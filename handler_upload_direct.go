@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Direct uploads let clients PUT video parts straight to the bucket through
+// presigned URLs, so the bytes never pass through this server. Clients need
+// the ETag response header of every part, so the bucket's CORS configuration
+// must expose it.
+
+const (
+	directUploadPartSize    = 64 << 20 // 64MB
+	directUploadMinPartSize = 5 << 20  // S3's minimum for all but the last part
+	directUploadMaxParts    = 10000
+	directUploadURLExpiry   = time.Hour
+	directUploadKeyPrefix   = "uploads"
+)
+
+func (cfg *apiConfig) handlerDirectUploadCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+	}
+	type part struct {
+		PartNumber int32  `json:"part_number"`
+		URL        string `json:"url"`
+	}
+	type response struct {
+		UploadID  string    `json:"upload_id"`
+		Key       string    `json:"key"`
+		PartSize  int64     `json:"part_size"`
+		Parts     []part    `json:"parts"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	presigner, ok := cfg.videoStorage.(storage.MultipartPresigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct uploads need S3 video storage", nil)
+		return
+	}
+
+	video := videoFromContext(r.Context())
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(params.ContentType)
+	if err != nil || !slices.Contains(cfg.videoTypes, mediaType) {
+		respondWithError(w, http.StatusBadRequest, "Invalid file type", err)
+		return
+	}
+	if params.Size <= 0 || params.Size > maxVideoUploadSize {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Size must be between 1 and %d bytes", maxVideoUploadSize), nil)
+		return
+	}
+
+	partSize := int64(directUploadPartSize)
+	if params.Size/partSize >= directUploadMaxParts {
+		partSize = (params.Size + directUploadMaxParts - 1) / directUploadMaxParts
+	}
+	partCount := (params.Size + partSize - 1) / partSize
+
+	randomBytes := make([]byte, 32)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate upload key", err)
+		return
+	}
+	key := fmt.Sprintf("%s/%s/%s.%s", directUploadKeyPrefix, video.ID, base64.RawURLEncoding.EncodeToString(randomBytes), videoExtensions[mediaType])
+
+	uploadID, err := presigner.CreateMultipartUpload(r.Context(), key, mediaType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create multipart upload", err)
+		return
+	}
+
+	parts := make([]part, 0, partCount)
+	for i := int32(1); i <= int32(partCount); i++ {
+		url, err := presigner.PresignUploadPart(r.Context(), key, uploadID, i, directUploadURLExpiry)
+		if err != nil {
+			presigner.AbortMultipartUpload(r.Context(), key, uploadID)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't presign upload part", err)
+			return
+		}
+		parts = append(parts, part{PartNumber: i, URL: url})
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{
+		UploadID:  uploadID,
+		Key:       key,
+		PartSize:  partSize,
+		Parts:     parts,
+		ExpiresAt: time.Now().UTC().Add(directUploadURLExpiry),
+	})
+}
+
+func (cfg *apiConfig) handlerDirectUploadComplete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		UploadID string                  `json:"upload_id"`
+		Key      string                  `json:"key"`
+		Parts    []storage.CompletedPart `json:"parts"`
+	}
+
+	presigner, ok := cfg.videoStorage.(storage.MultipartPresigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct uploads need S3 video storage", nil)
+		return
+	}
+
+	video := videoFromContext(r.Context())
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !isDirectUploadKey(params.Key, video.ID) || params.UploadID == "" {
+		respondWithError(w, http.StatusBadRequest, "Upload doesn't belong to this video", nil)
+		return
+	}
+	if len(params.Parts) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No parts given", nil)
+		return
+	}
+	sort.Slice(params.Parts, func(i, j int) bool { return params.Parts[i].PartNumber < params.Parts[j].PartNumber })
+
+	// Clients retry completion when the response is lost; S3 has forgotten
+	// the upload by then, so answer with the job the first call queued
+	dedupeKey := "direct-upload:" + params.UploadID
+	if cfg.respondWithDirectUploadJob(w, dedupeKey, video.ID) {
+		return
+	}
+
+	err = presigner.CompleteMultipartUpload(r.Context(), params.Key, params.UploadID, params.Parts)
+	if err != nil {
+		// A concurrent call may have completed it first
+		if cfg.respondWithDirectUploadJob(w, dedupeKey, video.ID) {
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Couldn't complete multipart upload", err)
+		return
+	}
+
+	// Check what actually landed in the bucket rather than trusting the client
+	info, err := cfg.videoStorage.Stat(r.Context(), params.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Uploaded object not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify uploaded object", err)
+		return
+	}
+	if info.Size == 0 || info.Size > maxVideoUploadSize {
+		cfg.videoStorage.Delete(r.Context(), params.Key)
+		respondWithError(w, http.StatusBadRequest, "Uploaded object has an invalid size", nil)
+		return
+	}
+
+	job, err := cfg.enqueueProcessVideo(video.UserID, video.ID, processVideoPayload{
+		SourceKey: params.Key,
+		MediaType: videoTypeForKey(params.Key),
+	}, dedupeKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to queue video processing", err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/jobs/%s", job.ID))
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// respondWithDirectUploadJob answers with the job already queued for a
+// direct upload, reporting whether there was one.
+func (cfg *apiConfig) respondWithDirectUploadJob(w http.ResponseWriter, dedupeKey string, videoID uuid.UUID) bool {
+	job, err := cfg.db.GetJobByDedupeKey(dedupeKey)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't look up video processing job", err)
+		return true
+	}
+	if job.ID == uuid.Nil {
+		return false
+	}
+	if job.VideoID == nil || *job.VideoID != videoID {
+		respondWithError(w, http.StatusBadRequest, "Upload doesn't belong to this video", nil)
+		return true
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/jobs/%s", job.ID))
+	respondWithJSON(w, http.StatusAccepted, job)
+	return true
+}
+
+func (cfg *apiConfig) handlerDirectUploadAbort(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		UploadID string `json:"upload_id"`
+		Key      string `json:"key"`
+	}
+
+	presigner, ok := cfg.videoStorage.(storage.MultipartPresigner)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct uploads need S3 video storage", nil)
+		return
+	}
+
+	video := videoFromContext(r.Context())
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !isDirectUploadKey(params.Key, video.ID) || params.UploadID == "" {
+		respondWithError(w, http.StatusBadRequest, "Upload doesn't belong to this video", nil)
+		return
+	}
+
+	err = presigner.AbortMultipartUpload(r.Context(), params.Key, params.UploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't abort multipart upload", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isDirectUploadKey checks that key is a staging key issued for videoID, so
+// clients can't complete or abort uploads for other videos.
+func isDirectUploadKey(key string, videoID uuid.UUID) bool {
+	prefix := fmt.Sprintf("%s/%s/", directUploadKeyPrefix, videoID)
+	rest, ok := strings.CutPrefix(key, prefix)
+	return ok && rest != "" && !strings.Contains(rest, "/")
+}
@@ -2,50 +2,21 @@ package main
 
 import (
 	"fmt"
+	"io"
     "mime"
-    "strings"
-    "path/filepath"
-    "os"
-    "io"
 	"net/http"
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"path"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
-	"github.com/google/uuid"
-    "crypto/rand"
-    "encoding/base64"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mediacheck"
+	thumb "github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/thumbnail"
 )
 
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
-		return
-	}
-
-    random_bytes := make([]byte, 32)
-    rand.Read(random_bytes)
-    thumbnail_name := base64.RawURLEncoding.EncodeToString(random_bytes)
-
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
+	videoID := videoFromContext(r.Context()).ID
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
-
-
-	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
-
-	// TODO: implement the upload here
-    const maxMemory = 10 << 20
-    r.ParseMultipartForm(maxMemory)
+    if !parseUploadForm(w, r, maxThumbnailUploadSize) {
+        return
+    }
 
     file, header, err := r.FormFile("thumbnail")
     if err != nil {
@@ -59,54 +30,71 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusBadRequest, "Invalid Content-Type", err)
 		return
 	}
-	if media_type != "image/jpeg" && media_type != "image/png" {
-		respondWithError(w, http.StatusBadRequest, "Invalid file type", nil)
+
+	// The declared type has to match what the bytes actually are
+	head, err := mediacheck.ReadHead(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to read file", err)
+		return
+	}
+	media_type, err = mediacheck.CheckType(head, media_type, acceptedThumbnailTypes)
+	if respondWithRejection(w, err) {
+		return
+	}
+	_, err = mediacheck.CheckImage(file, cfg.imageLimits)
+	if respondWithRejection(w, err) {
+		return
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to read file", err)
 		return
 	}
-    media_type = strings.Split(media_type, "/")[1]
 
-    /*
 	image_byte, err := io.ReadAll(file)
 	if err != nil {
         respondWithError(w, http.StatusBadRequest, "Unable to read file", err)
         return
 	}
-    */
 
-    metadata, err := cfg.db.GetVideo(videoID)
-    if (metadata.UserID != userID && metadata != database.Video{}) {
-        respondWithError(w, http.StatusUnauthorized, "User not owner of video", err)
-        return
-    } else if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to fetch video from database", err)
+    // Re-encoding drops EXIF and anything else riding along in the file
+    img, err := thumb.Decode(image_byte)
+    if err != nil {
+        respondWithRejection(w, &mediacheck.Rejection{
+            Code:    "undecodable_image",
+            Message: fmt.Sprintf("Couldn't read image: %v", err),
+        })
         return
     }
 
-    //assetPath := getAssetPath(thumbnail_name, media_type)
-	//assetDiskPath := cfg.getAssetDiskPath(assetPath)
-    file_dir := filepath.Join(cfg.assetsRoot, fmt.Sprintf("%s.%s", thumbnail_name, media_type))
-    image_file, err := os.Create(file_dir)
+    thumbnail_key, renditions, err := cfg.storeThumbnail(r.Context(), img)
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to create image in file dir", err)
+        respondWithError(w, http.StatusInternalServerError, "Failed to store thumbnail", err)
         return
     }
-    defer image_file.Close()
 
-    _, err = io.Copy(image_file, file)
+    thumbnailURL := cfg.thumbnailStorage.URL(thumbnail_key)
+
+    // Only the thumbnail columns are written, so edits made during the upload stick
+    found, err := cfg.db.SetUploadedThumbnail(videoID, thumbnailURL, thumbnail_key, renditions)
+    if err != nil || !found {
+        cfg.deleteStoredObjects(r.Context(), cfg.thumbnailStorage, path.Dir(thumbnail_key)+"/", true)
+    }
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to write to image file", err)
+        respondWithError(w, http.StatusInternalServerError, "Failed to update video database", err)
+        return
+    }
+    if !found {
+        respondWithError(w, http.StatusNotFound, "Couldn't find video", nil)
         return
     }
 
-    thumbnailURL := fmt.Sprintf("http://localhost:%s/assets/%s.%s", cfg.port, thumbnail_name, media_type)
-
-    metadata.ThumbnailURL = &thumbnailURL
-    err = cfg.db.UpdateVideo(metadata)
+    metadata, err := cfg.db.GetVideo(videoID)
     if err != nil {
-        respondWithError(w, http.StatusInternalServerError, "Failed to update video database", err)
+        respondWithError(w, http.StatusInternalServerError, "Failed to fetch video from database", err)
         return
     }
 
 
-	respondWithJSON(w, http.StatusOK, metadata)
+	respondWithJSON(w, http.StatusOK, cfg.resolveVideoURLs(r.Context(), metadata))
 }
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// This file implements the tus 1.0 resumable upload protocol
+// (https://tus.io/protocols/resumable-upload) with the creation, termination
+// and expiration extensions. Chunks are appended to a file in the tus spool
+// directory; the finished file goes through the same processing job as
+// POST /api/video_upload.
+
+const (
+	tusVersion         = "1.0.0"
+	tusExtensions      = "creation,termination,expiration"
+	maxVideoUploadSize = 1 << 30 // 1GB
+	tusUploadExpiry    = 24 * time.Hour
+	tusSweepInterval   = 10 * time.Minute
+)
+
+// uploadLocks serialises PATCH requests per upload so two clients can't
+// interleave writes to the same file.
+type uploadLocks struct {
+	mu    sync.Mutex
+	locks map[uuid.UUID]bool
+}
+
+func (l *uploadLocks) tryLock(id uuid.UUID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks == nil {
+		l.locks = map[uuid.UUID]bool{}
+	}
+	if l.locks[id] {
+		return false
+	}
+	l.locks[id] = true
+	return true
+}
+
+func (l *uploadLocks) unlock(id uuid.UUID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.locks, id)
+}
+
+func (cfg *apiConfig) tusDir() string {
+	return filepath.Join(cfg.spoolDir, "tus")
+}
+
+func (cfg *apiConfig) tusFilePath(id uuid.UUID) string {
+	return filepath.Join(cfg.tusDir(), id.String())
+}
+
+// tusMiddleware adds the headers every tus response carries and rejects
+// clients speaking another protocol version.
+func tusMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			respondWithError(w, http.StatusPreconditionFailed, "Unsupported tus version", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (cfg *apiConfig) handlerTusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.Itoa(maxVideoUploadSize))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerTusCreate(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(r.Context())
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		respondWithError(w, http.StatusBadRequest, "Deferred upload length is not supported", nil)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Length", err)
+		return
+	}
+	// An empty file can never be a video
+	if length == 0 {
+		respondWithError(w, http.StatusBadRequest, "Upload-Length must be positive", nil)
+		return
+	}
+	if length > maxVideoUploadSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Upload is too large", nil)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Metadata", err)
+		return
+	}
+	videoID, err := uuid.Parse(metadata["video_id"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Upload-Metadata must include a valid video_id", err)
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(metadata["filetype"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Upload-Metadata must include a filetype", err)
+		return
+	}
+	if !slices.Contains(cfg.videoTypes, mediaType) {
+		respondWithError(w, http.StatusBadRequest, "Invalid file type", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to fetch video from database", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You don't own this video", nil)
+		return
+	}
+
+	upload, err := cfg.db.CreateUpload(database.CreateUploadParams{
+		UserID:    userID,
+		VideoID:   videoID,
+		Length:    length,
+		MediaType: mediaType,
+		Metadata:  r.Header.Get("Upload-Metadata"),
+		ExpiresAt: time.Now().Add(tusUploadExpiry),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+
+	f, err := os.Create(cfg.tusFilePath(upload.ID))
+	if err != nil {
+		cfg.db.DeleteUpload(upload.ID)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload file", err)
+		return
+	}
+	f.Close()
+
+	w.Header().Set("Location", fmt.Sprintf("/api/uploads/%s", upload.ID))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (cfg *apiConfig) handlerTusHead(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.tusGetOwnedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	if upload.JobID != nil {
+		w.Header().Set("Tubely-Job-Id", upload.JobID.String())
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerTusPatch(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.tusGetOwnedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream", nil)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Offset", err)
+		return
+	}
+
+	if !cfg.uploadLocks.tryLock(upload.ID) {
+		respondWithError(w, http.StatusLocked, "Upload is already being written to", nil)
+		return
+	}
+	defer cfg.uploadLocks.unlock(upload.ID)
+
+	// The row read before taking the lock may predate a PATCH that finished
+	// since, and truncating to its offset would throw those bytes away
+	upload, err = cfg.db.GetUpload(upload.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return
+	}
+	if upload.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Upload not found", nil)
+		return
+	}
+	if upload.CompletedAt != nil || offset != upload.Offset {
+		respondWithError(w, http.StatusConflict, "Upload-Offset doesn't match the current offset", nil)
+		return
+	}
+
+	f, err := os.OpenFile(cfg.tusFilePath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open upload file", err)
+		return
+	}
+	defer f.Close()
+
+	// Drop anything past the recorded offset, left over from a write that
+	// failed before the offset was saved
+	err = f.Truncate(upload.Offset)
+	if err == nil {
+		_, err = f.Seek(upload.Offset, io.SeekStart)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't prepare upload file", err)
+		return
+	}
+
+	// Keep whatever arrived even if the client disconnects mid-chunk, so it
+	// can resume from there
+	remaining := upload.Length - upload.Offset
+	written, copyErr := io.Copy(f, io.LimitReader(r.Body, remaining))
+	if written > 0 {
+		ok, err := cfg.db.AdvanceUploadOffset(upload.ID, upload.Offset, upload.Offset+written)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't save upload offset", err)
+			return
+		}
+		if !ok {
+			respondWithError(w, http.StatusConflict, "Upload was modified concurrently", nil)
+			return
+		}
+		upload.Offset += written
+	}
+	if copyErr != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read request body", copyErr)
+		return
+	}
+
+	if upload.Offset == upload.Length {
+		f.Close()
+		job, err := cfg.finishTusUpload(upload)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to queue video processing", err)
+			return
+		}
+		w.Header().Set("Tubely-Job-Id", job.ID.String())
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerTusDelete(w http.ResponseWriter, r *http.Request) {
+	upload, ok := cfg.tusGetOwnedUpload(w, r)
+	if !ok {
+		return
+	}
+
+	if !cfg.uploadLocks.tryLock(upload.ID) {
+		respondWithError(w, http.StatusLocked, "Upload is being written to", nil)
+		return
+	}
+	defer cfg.uploadLocks.unlock(upload.ID)
+
+	err := cfg.removeTusUpload(upload)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete upload", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishTusUpload hands a complete upload over to the processing job, which
+// takes ownership of the file. Calling it again for the same upload returns
+// the same job.
+func (cfg *apiConfig) finishTusUpload(upload database.Upload) (database.Job, error) {
+	job, err := cfg.enqueueProcessVideo(upload.UserID, upload.VideoID, processVideoPayload{
+		SourcePath: cfg.tusFilePath(upload.ID),
+		MediaType:  upload.MediaType,
+	}, "tus:"+upload.ID.String())
+	if err != nil {
+		return database.Job{}, err
+	}
+	err = cfg.db.CompleteUpload(upload.ID, job.ID)
+	if err != nil {
+		return database.Job{}, err
+	}
+	return job, nil
+}
+
+// removeTusUpload deletes an upload and, unless a job already owns it, its file.
+func (cfg *apiConfig) removeTusUpload(upload database.Upload) error {
+	if upload.CompletedAt == nil {
+		err := os.Remove(cfg.tusFilePath(upload.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return cfg.db.DeleteUpload(upload.ID)
+}
+
+// sweepExpiredUploads implements the expiration extension by periodically
+// discarding uploads past their Upload-Expires time.
+func (cfg *apiConfig) sweepExpiredUploads(ctx context.Context) {
+	ticker := time.NewTicker(tusSweepInterval)
+	defer ticker.Stop()
+	for {
+		uploads, err := cfg.db.GetExpiredUploads(time.Now())
+		if err != nil {
+			log.Printf("couldn't list expired uploads: %v", err)
+		}
+		for _, upload := range uploads {
+			if !cfg.uploadLocks.tryLock(upload.ID) {
+				continue
+			}
+			err := cfg.removeTusUpload(upload)
+			cfg.uploadLocks.unlock(upload.ID)
+			if err != nil {
+				log.Printf("couldn't remove expired upload %s: %v", upload.ID, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tusGetOwnedUpload loads the upload named in the path, treating expired
+// uploads as gone and refusing access to other users' uploads.
+func (cfg *apiConfig) tusGetOwnedUpload(w http.ResponseWriter, r *http.Request) (database.Upload, bool) {
+	userID := userIDFromContext(r.Context())
+
+	uploadID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Upload not found", err)
+		return database.Upload{}, false
+	}
+	upload, err := cfg.db.GetUpload(uploadID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return database.Upload{}, false
+	}
+	if upload.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Upload not found", nil)
+		return database.Upload{}, false
+	}
+	if upload.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You don't own this upload", nil)
+		return database.Upload{}, false
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		respondWithError(w, http.StatusGone, "Upload has expired", nil)
+		return database.Upload{}, false
+	}
+	return upload, true
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated pairs
+// of a key and an optional base64-encoded value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
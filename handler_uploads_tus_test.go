@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestTusCreateRejectsBadLengths(t *testing.T) {
+	cfg := newTestConfig(t)
+	tests := []struct {
+		name   string
+		length string
+		want   int
+	}{
+		{"missing", "", http.StatusBadRequest},
+		{"negative", "-1", http.StatusBadRequest},
+		{"empty file", "0", http.StatusBadRequest},
+		{"too large", strconv.Itoa(maxVideoUploadSize + 1), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/uploads", nil)
+			r.Header.Set("Tus-Resumable", tusVersion)
+			if tt.length != "" {
+				r.Header.Set("Upload-Length", tt.length)
+			}
+			w := httptest.NewRecorder()
+			cfg.handlerTusCreate(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
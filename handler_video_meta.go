@@ -1,15 +1,15 @@
 package main
 
 import (
-    "os"
-    "errors"
     "fmt"
-    "bytes"
     "os/exec"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
-	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
@@ -19,25 +19,18 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		database.CreateVideoParams
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
-	}
-
 	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
-	params.UserID = userID
+	params.UserID = userIDFromContext(r.Context())
+	if params.Visibility != "" && !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Visibility must be public, unlisted or private", nil)
+		return
+	}
 
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
@@ -49,21 +42,32 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 }
 
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
-		return
-	}
+	video := videoFromContext(r.Context())
 
-	token, err := auth.GetBearerToken(r.Header)
+	err := cfg.deleteVideo(video.ID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteVideo deletes a video along with any direct uploads for it that were
+// never completed or processed.
+func (cfg *apiConfig) deleteVideo(videoID uuid.UUID) error {
+	return cfg.db.DeleteVideo(videoID, database.CreateTombstoneParams{
+		Store:  database.TombstoneStoreVideo,
+		Key:    fmt.Sprintf("%s/%s/", directUploadKeyPrefix, videoID),
+		Prefix: true,
+	})
+}
+
+func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
 		return
 	}
 
@@ -72,116 +76,208 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
-	if video.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
+	// Private videos are only visible to their owner. Anyone else gets the
+	// same 404 as for a missing video so IDs can't be probed.
+	if !cfg.canViewVideo(r, video) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, cfg.resolveVideoURLs(r.Context(), video))
 }
 
-func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
+func (cfg *apiConfig) handlerVideoVisibilityUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Visibility database.Visibility `json:"visibility"`
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Visibility must be public, unlisted or private", nil)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video := videoFromContext(r.Context())
+	version := video.Version
+	// The copies are only referenced once the row is saved
+	discardCopies := func() {}
+	if params.Visibility == database.VisibilityPrivate && video.Visibility != database.VisibilityPrivate {
+		video, discardCopies, err = cfg.rotateVideoKeys(r.Context(), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't make video private", err)
+			return
+		}
+	}
+
+	video.Visibility = params.Visibility
+	cfg.applyVideoVisibility(&video)
+	err = cfg.db.UpdateVideoIfVersion(video, version)
+	if errors.Is(err, database.ErrVideoConflict) {
+		discardCopies()
+		respondWithError(w, http.StatusConflict, "Video was changed since it was read", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		discardCopies()
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.resolveVideoURLs(r.Context(), video))
 }
 
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	params, err := parseListVideosQuery(r.URL.Query())
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	params.UserID = userIDFromContext(r.Context())
+
+	page, err := cfg.db.ListVideos(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
 		return
 	}
-
-	videos, err := cfg.db.GetVideos(userID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
+	videos := page.Videos
+	for i := range videos {
+		videos[i] = cfg.resolveVideoURLs(r.Context(), videos[i])
+	}
 
+	// The body stays a plain array for existing clients; the next page is
+	// advertised in headers
+	if page.NextCursor != "" {
+		next := r.URL.Query()
+		next.Set("cursor", page.NextCursor)
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
 	respondWithJSON(w, http.StatusOK, videos)
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
+const (
+	defaultVideoPageSize = 50
+	maxVideoPageSize     = 200
+)
 
-    fmt.Println(filePath)
+// parseListVideosQuery reads the paging, sorting and filtering parameters of
+// GET /api/videos. Requests without limit or cursor get the whole list, as
+// they did before paging existed.
+func parseListVideosQuery(q url.Values) (database.ListVideosParams, error) {
+	params := database.ListVideosParams{
+		Sort:   database.VideoSortCreatedAt,
+		Cursor: q.Get("cursor"),
+		Aspect: q.Get("aspect"),
+	}
 
-    if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
-        return "", fmt.Errorf("File dosen't exist: %w", err)
-    }
-    // Secureity risk without cleaning?
-    //cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-    // Set up the ffprobe command
-	cmd := exec.Command(
-		"ffprobe",
-		"-v", "error",           // Suppress verbose output, show only errors
-		"-print_format", "json", // Output in JSON format
-		"-show_streams",         // Show stream information
-		filePath,               // Path to the video file
-	)
-
-    var buffer bytes.Buffer
-    cmd.Stdout = &buffer
-
-    fmt.Println("Got this far")
-    err := cmd.Run()
-    if err != nil {
-        return "", fmt.Errorf("Failed to run command: %s", err)
-    }
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxVideoPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", maxVideoPageSize)
+		}
+		params.Limit = limit
+	} else if params.Cursor != "" {
+		params.Limit = defaultVideoPageSize
+	}
 
-    // Stream represents a single stream in the ffprobe output
-    type Stream struct {
-        Width          int    `json:"width"`
-        Height         int    `json:"height"`
-    }
+	if s := q.Get("sort"); s != "" {
+		params.Sort = database.VideoSort(s)
+		if !params.Sort.Valid() {
+			return params, errors.New("sort must be created_at, updated_at, title or duration")
+		}
+	}
+	// Titles read naturally A to Z; everything else newest or longest first
+	params.Ascending = params.Sort == database.VideoSortTitle
+	switch q.Get("order") {
+	case "":
+	case "asc":
+		params.Ascending = true
+	case "desc":
+		params.Ascending = false
+	default:
+		return params, errors.New("order must be asc or desc")
+	}
 
-    // FFProbeOutput represents the top-level ffprobe JSON structure
-    type FFProbeOutput struct {
-        Streams []Stream `json:"streams"`
-    }
+	var err error
+	params.HasVideo, err = parseOptionalBool(q, "has_video")
+	if err != nil {
+		return params, err
+	}
+	params.HasThumbnail, err = parseOptionalBool(q, "has_thumbnail")
+	if err != nil {
+		return params, err
+	}
+	params.CreatedAfter, err = parseOptionalTime(q, "created_after")
+	if err != nil {
+		return params, err
+	}
+	params.CreatedBefore, err = parseOptionalTime(q, "created_before")
+	if err != nil {
+		return params, err
+	}
 
+	switch params.Aspect {
+	case "", "landscape", "portrait", "other":
+	default:
+		return params, errors.New("aspect must be landscape, portrait or other")
+	}
 
-	params := FFProbeOutput{}
-    fmt.Println("Got this far")
-    err = json.Unmarshal(buffer.Bytes(), &params)
-    if err != nil {
-        return "", fmt.Errorf("Failed to Unmarshal output: %w", err)
-    }
+	params.Tags = q["tag"]
+	for _, tag := range params.Tags {
+		if _, err := database.NormalizeTagName(tag); err != nil {
+			return params, err
+		}
+	}
+	return params, nil
+}
 
-    fmt.Println(params)
-
-    aspect_ratio := float64(params.Streams[0].Width / params.Streams[0].Height)
-    // margin := 0.1
-    switch aspect_ratio {
-    case 16/9://float64(16/9) - margin < aspect_ratio < float64(16/9) + margin:
-        return "16:9", nil
-    case 9/16:
-        return "9:16", nil
-    default:
-        return "other", nil
-    }
+func parseOptionalBool(q url.Values, name string) (*bool, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", name)
+	}
+	return &b, nil
+}
+
+func parseOptionalTime(q url.Values, name string) (*time.Time, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		// Plain dates are convenient for ranges
+		t, err = time.Parse(time.DateOnly, s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", name)
+	}
+	return &t, nil
 }
 
 func processVideoForFastStart(filePath string) (string, error) {
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+// handlerVideosSearch runs a full-text search over the caller's videos and
+// every public video. Results are ranked, so pages are chosen by offset.
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	userID := userIDFromContext(r.Context())
+
+	q := r.URL.Query()
+	params := database.SearchVideosParams{
+		UserID: userID,
+		Query:  q.Get("q"),
+		Limit:  defaultSearchPageSize,
+	}
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxSearchPageSize {
+			err = fmt.Errorf("limit must be between 1 and %d", maxSearchPageSize)
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+		params.Limit = limit
+	}
+	if s := q.Get("offset"); s != "" {
+		offset, err := strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset must be a non-negative integer", err)
+			return
+		}
+		params.Offset = offset
+	}
+
+	results, err := cfg.db.SearchVideos(params)
+	if errors.Is(err, database.ErrEmptySearch) {
+		respondWithError(w, http.StatusBadRequest, "Search query must contain at least one word", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+	for i := range results {
+		results[i].Video = cfg.resolveVideoURLs(r.Context(), results[i].Video)
+	}
+	respondWithJSON(w, http.StatusOK, results)
+}
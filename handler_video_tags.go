@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTagSuggestions = 10
+	maxTagSuggestions     = 50
+)
+
+// handlerVideoTagsGet lists a video's tags to anyone who can see the video.
+func (cfg *apiConfig) handlerVideoTagsGet(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !cfg.canViewVideo(r, video) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
+
+	tags, err := cfg.db.GetVideoTags(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get tags", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tags)
+}
+
+// handlerVideoTagsAdd adds tags to the caller's video and responds with all of
+// its tags.
+func (cfg *apiConfig) handlerVideoTagsAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Tags []string `json:"tags"`
+	}
+
+	video := videoFromContext(r.Context())
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.Tags) == 0 {
+		respondWithError(w, http.StatusBadRequest, "No tags given", nil)
+		return
+	}
+
+	tags, err := cfg.db.AddVideoTags(video.ID, params.Tags)
+	if errors.Is(err, database.ErrInvalidTag) || errors.Is(err, database.ErrTooManyTags) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add tags", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tags)
+}
+
+func (cfg *apiConfig) handlerVideoTagDelete(w http.ResponseWriter, r *http.Request) {
+	video := videoFromContext(r.Context())
+
+	err := cfg.db.RemoveVideoTag(video.ID, r.PathValue("tag"))
+	if errors.Is(err, database.ErrInvalidTag) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove tag", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerTagsSuggest autocompletes tag names from ?prefix=.
+func (cfg *apiConfig) handlerTagsSuggest(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTagSuggestions
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxTagSuggestions {
+			err = fmt.Errorf("limit must be between 1 and %d", maxTagSuggestions)
+			respondWithError(w, http.StatusBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	suggestions, err := cfg.db.SuggestTags(userIDFromContext(r.Context()), r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't suggest tags", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, suggestions)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 5000
+)
+
+// videoETag is a strong validator for a video's metadata.
+func videoETag(video database.Video) string {
+	return `"` + strconv.Itoa(video.Version) + `"`
+}
+
+// etagMatches reports whether an If-Match header lists etag. Weak tags never
+// match, as If-Match uses strong comparison.
+func etagMatches(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerVideoUpdate applies a partial update to a video's metadata. Fields
+// left out of the body keep their values. Send the ETag from a previous
+// response in If-Match to make sure no one else changed the video since.
+func (cfg *apiConfig) handlerVideoUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string              `json:"title"`
+		Description *string              `json:"description"`
+		Visibility  *database.Visibility `json:"visibility"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video := videoFromContext(r.Context())
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && !etagMatches(ifMatch, videoETag(video)) {
+		w.Header().Set("ETag", videoETag(video))
+		respondWithError(w, http.StatusConflict, "Video was changed since it was read", nil)
+		return
+	}
+
+	if params.Title != nil {
+		title := strings.TrimSpace(*params.Title)
+		if title == "" || utf8.RuneCountInString(title) > maxVideoTitleLength {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Title must be 1 to %d characters", maxVideoTitleLength), nil)
+			return
+		}
+		video.Title = title
+	}
+	if params.Description != nil {
+		if utf8.RuneCountInString(*params.Description) > maxVideoDescriptionLength {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Description must be at most %d characters", maxVideoDescriptionLength), nil)
+			return
+		}
+		video.Description = *params.Description
+	}
+	// Copies made for a private video are only referenced once the row is
+	// saved
+	discardCopies := func() {}
+	if params.Visibility != nil {
+		if !params.Visibility.Valid() {
+			respondWithError(w, http.StatusBadRequest, "Visibility must be public, unlisted or private", nil)
+			return
+		}
+		if *params.Visibility == database.VisibilityPrivate && video.Visibility != database.VisibilityPrivate {
+			video, discardCopies, err = cfg.rotateVideoKeys(r.Context(), video)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't make video private", err)
+				return
+			}
+		}
+		video.Visibility = *params.Visibility
+		cfg.applyVideoVisibility(&video)
+	}
+
+	// Even without If-Match, a change landing between our read and write
+	// must not be overwritten
+	err = cfg.db.UpdateVideoIfVersion(video, video.Version)
+	if errors.Is(err, database.ErrVideoConflict) {
+		discardCopies()
+		respondWithError(w, http.StatusConflict, "Video was changed since it was read", err)
+		return
+	}
+	if err != nil {
+		discardCopies()
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, cfg.resolveVideoURLs(r.Context(), video))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	hlsSegmentSeconds   = 6
+	hlsMasterPlaylist   = "master.m3u8"
+	hlsDefaultAudioRate = "128k"
+)
+
+// hlsRung is one step of the adaptive-bitrate ladder. Height is the length of
+// the short side, so a 720 rung is 1280x720 for landscape and 720x1280 for
+// portrait video.
+type hlsRung struct {
+	Height       int
+	VideoBitrate string
+	AudioBitrate string
+}
+
+var defaultHLSLadder = []hlsRung{
+	{Height: 1080, VideoBitrate: "5000k", AudioBitrate: "192k"},
+	{Height: 720, VideoBitrate: "2800k", AudioBitrate: "128k"},
+	{Height: 480, VideoBitrate: "1400k", AudioBitrate: "128k"},
+	{Height: 360, VideoBitrate: "800k", AudioBitrate: "96k"},
+}
+
+// parseHLSLadder parses HLS_LADDER values such as "1080:5000k:192k,720:2800k".
+// The audio bitrate is optional. An empty string selects the default ladder
+// and "none" disables HLS packaging.
+func parseHLSLadder(s string) ([]hlsRung, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return defaultHLSLadder, nil
+	}
+	if s == "none" {
+		return nil, nil
+	}
+
+	ladder := []hlsRung{}
+	for _, field := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid rung %q, expected height:video_bitrate[:audio_bitrate]", field)
+		}
+		height, err := strconv.Atoi(parts[0])
+		if err != nil || height <= 0 || height%2 != 0 {
+			return nil, fmt.Errorf("invalid rung height %q, must be a positive even number", parts[0])
+		}
+		rung := hlsRung{
+			Height:       height,
+			VideoBitrate: parts[1],
+			AudioBitrate: hlsDefaultAudioRate,
+		}
+		if len(parts) == 3 {
+			rung.AudioBitrate = parts[2]
+		}
+		ladder = append(ladder, rung)
+	}
+	sort.Slice(ladder, func(i, j int) bool { return ladder[i].Height > ladder[j].Height })
+	return ladder, nil
+}
+
+// selectHLSRungs drops rungs that would upscale the source. A source smaller
+// than every rung still gets a single rendition at its own size.
+func selectHLSRungs(ladder []hlsRung, width, height int) []hlsRung {
+	shortSide := min(width, height)
+	rungs := []hlsRung{}
+	for _, rung := range ladder {
+		if rung.Height <= shortSide {
+			rungs = append(rungs, rung)
+		}
+	}
+	if len(rungs) == 0 && len(ladder) > 0 {
+		fallback := ladder[len(ladder)-1]
+		fallback.Height = shortSide - shortSide%2
+		rungs = append(rungs, fallback)
+	}
+	return rungs
+}
+
+// transcodeHLS packages filePath into outDir as one HLS variant per rung plus
+// a master playlist referencing them all. The layout is kept flat because
+// ffmpeg writes the master playlist next to the variant playlists.
+func transcodeHLS(ctx context.Context, filePath, outDir string, rungs []hlsRung, width, height int, hasAudio bool) error {
+	portrait := height > width
+
+	split := fmt.Sprintf("[0:v]split=%d", len(rungs))
+	for i := range rungs {
+		split += fmt.Sprintf("[v%d]", i)
+	}
+	filters := []string{split}
+	for i, rung := range rungs {
+		scale := fmt.Sprintf("scale=-2:%d", rung.Height)
+		if portrait {
+			scale = fmt.Sprintf("scale=%d:-2", rung.Height)
+		}
+		filters = append(filters, fmt.Sprintf("[v%d]%s[v%dout]", i, scale, i))
+	}
+
+	args := []string{
+		"-v", "error",
+		"-i", filePath,
+		"-filter_complex", strings.Join(filters, ";"),
+	}
+	streamMap := []string{}
+	for i, rung := range rungs {
+		args = append(args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), "libx264",
+			fmt.Sprintf("-b:v:%d", i), rung.VideoBitrate,
+			fmt.Sprintf("-maxrate:v:%d", i), rung.VideoBitrate,
+			fmt.Sprintf("-bufsize:v:%d", i), rung.VideoBitrate,
+		)
+		entry := fmt.Sprintf("v:%d", i)
+		if hasAudio {
+			args = append(args,
+				"-map", "a:0",
+				fmt.Sprintf("-c:a:%d", i), "aac",
+				fmt.Sprintf("-b:a:%d", i), rung.AudioBitrate,
+			)
+			entry += fmt.Sprintf(",a:%d", i)
+		}
+		streamMap = append(streamMap, entry)
+	}
+	args = append(args,
+		"-preset", "veryfast",
+		// Keyframes on segment boundaries keep variants switchable
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", hlsSegmentSeconds),
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(hlsSegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(outDir, "stream_%v_%03d.ts"),
+		"-master_pl_name", hlsMasterPlaylist,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(outDir, "stream_%v.m3u8"),
+	)
+
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// uploadHLSTree stores every file below dir under keyPrefix and returns the
+// key of the master playlist.
+func (cfg *apiConfig) uploadHLSTree(ctx context.Context, dir, keyPrefix string) (string, error) {
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		contentType := "video/mp2t"
+		if strings.HasSuffix(p, ".m3u8") {
+			contentType = "application/vnd.apple.mpegurl"
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return cfg.videoStorage.Put(ctx, path.Join(keyPrefix, filepath.ToSlash(rel)), f, contentType)
+	})
+	if err != nil {
+		return "", fmt.Errorf("couldn't upload HLS files: %w", err)
+	}
+	return path.Join(keyPrefix, hlsMasterPlaylist), nil
+}
+
+// hlsKeyPrefix places the HLS tree next to the MP4 it was generated from,
+// e.g. landscape/abc.mp4 -> landscape/abc/hls.
+func hlsKeyPrefix(videoKey string) string {
+	return strings.TrimSuffix(videoKey, path.Ext(videoKey)) + "/hls"
+}
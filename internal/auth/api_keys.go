@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to spot.
+const APIKeyPrefix = "tubely_"
+
+// Scope limits what an API key may be used for. Access tokens from logging
+// in carry every scope.
+type Scope string
+
+const (
+	ScopeVideosRead  Scope = "videos:read"
+	ScopeVideosWrite Scope = "videos:write"
+)
+
+var AllScopes = []Scope{ScopeVideosRead, ScopeVideosWrite}
+
+func (s Scope) Valid() bool {
+	switch s {
+	case ScopeVideosRead, ScopeVideosWrite:
+		return true
+	}
+	return false
+}
+
+// MakeAPIKey returns a new random API key. Only its hash should be stored.
+func MakeAPIKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// HashAPIKey hashes an API key for storage and lookup. Keys are random, so a
+// fast unsalted hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than a
+// JWT.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
@@ -0,0 +1,52 @@
+package auth
+
+import "slices"
+
+// Role is what a user is allowed to do beyond managing their own content.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// Permission names an action on content that isn't the user's own, or on the
+// service itself.
+type Permission string
+
+const (
+	PermViewAnyVideo   Permission = "videos:view_any"
+	PermDeleteAnyVideo Permission = "videos:delete_any"
+	PermListUsers      Permission = "users:list"
+	PermManageUsers    Permission = "users:manage"
+	PermResetDatabase  Permission = "admin:reset"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser: nil,
+	RoleModerator: {
+		PermViewAnyVideo,
+		PermDeleteAnyVideo,
+	},
+	RoleAdmin: {
+		PermViewAnyVideo,
+		PermDeleteAnyVideo,
+		PermListUsers,
+		PermManageUsers,
+		PermResetDatabase,
+	},
+}
+
+// Can reports whether the role grants perm. Unknown roles grant nothing.
+func (r Role) Can(perm Permission) bool {
+	return slices.Contains(rolePermissions[r], perm)
+}
@@ -0,0 +1,146 @@
+// Package cdn signs CloudFront URLs and cookies so protected content can be
+// served through the distribution instead of straight from the bucket.
+package cdn
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
+)
+
+// Signer signs requests with a CloudFront key pair. It is safe for
+// concurrent use.
+type Signer struct {
+	urls    *sign.URLSigner
+	cookies *sign.CookieSigner
+}
+
+// NewSigner loads the PEM private key at privateKeyPath, in either PKCS#1 or
+// PKCS#8 form. Signed cookies are scoped to cookieDomain, which must be a
+// parent of both the API's and the distribution's host names for browsers to
+// send them to CloudFront. An empty domain scopes them to the API host.
+func NewSigner(keyPairID, privateKeyPath, cookieDomain string) (*Signer, error) {
+	if keyPairID == "" {
+		return nil, errors.New("key pair ID is empty")
+	}
+	data, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read private key: %w", err)
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse private key %s: %w", privateKeyPath, err)
+	}
+
+	return &Signer{
+		urls: sign.NewURLSigner(keyPairID, key),
+		cookies: sign.NewCookieSigner(keyPairID, key, func(o *sign.CookieOptions) {
+			o.Path = "/"
+			o.Domain = cookieDomain
+			o.Secure = true
+			o.SameSite = http.SameSiteNoneMode
+		}),
+	}, nil
+}
+
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	key, err := sign.LoadPEMPrivKey(bytes.NewReader(data))
+	if err == nil {
+		return key, nil
+	}
+	parsed, pkcs8Err := sign.LoadPEMPrivKeyPKCS8(bytes.NewReader(data))
+	if pkcs8Err != nil {
+		return nil, err
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("CloudFront keys must be RSA")
+	}
+	return rsaKey, nil
+}
+
+// SignURL signs rawURL with a canned policy, which only grants access to that
+// exact URL until expires.
+func (s *Signer) SignURL(rawURL string, expires time.Time) (string, error) {
+	signed, err := s.urls.Sign(rawURL, expires)
+	if err != nil {
+		return "", fmt.Errorf("couldn't sign %s: %w", rawURL, err)
+	}
+	return signed, nil
+}
+
+// Policy is a custom policy statement. Only Resource and Expires are
+// required.
+type Policy struct {
+	// Resource is the URL the policy grants access to. It may contain *
+	// wildcards.
+	Resource string
+	Expires  time.Time
+	// Starts delays access until that time. Zero grants it immediately.
+	Starts time.Time
+	// SourceIP restricts access to an IPv4 CIDR range such as 192.0.2.0/24.
+	// Empty allows any address.
+	SourceIP string
+}
+
+func (p Policy) statement() (*sign.Policy, error) {
+	if p.Resource == "" {
+		return nil, errors.New("policy has no resource")
+	}
+	if !p.Starts.IsZero() && !p.Starts.Before(p.Expires) {
+		return nil, errors.New("policy starts after it expires")
+	}
+	cond := sign.Condition{DateLessThan: sign.NewAWSEpochTime(p.Expires)}
+	if !p.Starts.IsZero() {
+		cond.DateGreaterThan = sign.NewAWSEpochTime(p.Starts)
+	}
+	if p.SourceIP != "" {
+		// CloudFront only matches IPv4 ranges
+		ip, _, err := net.ParseCIDR(p.SourceIP)
+		if err != nil || ip.To4() == nil {
+			return nil, fmt.Errorf("source IP %q isn't an IPv4 CIDR range", p.SourceIP)
+		}
+		cond.IPAddress = &sign.IPAddress{SourceIP: p.SourceIP}
+	}
+	return &sign.Policy{
+		Statements: []sign.Statement{{Resource: p.Resource, Condition: cond}},
+	}, nil
+}
+
+// SignURLWithPolicy signs rawURL with a custom policy, which can cover many
+// URLs through wildcards and restrict when and from where they're fetched.
+func (s *Signer) SignURLWithPolicy(rawURL string, policy Policy) (string, error) {
+	statement, err := policy.statement()
+	if err != nil {
+		return "", err
+	}
+	signed, err := s.urls.SignWithPolicy(rawURL, statement)
+	if err != nil {
+		return "", fmt.Errorf("couldn't sign %s: %w", rawURL, err)
+	}
+	return signed, nil
+}
+
+// SignCookies returns the CloudFront-Policy, CloudFront-Signature and
+// CloudFront-Key-Pair-Id cookies granting what policy allows. The cookies
+// themselves expire with the policy.
+func (s *Signer) SignCookies(policy Policy) ([]*http.Cookie, error) {
+	statement, err := policy.statement()
+	if err != nil {
+		return nil, err
+	}
+	cookies, err := s.cookies.SignWithPolicy(statement, func(o *sign.CookieOptions) {
+		o.Expires = policy.Expires
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't sign cookies for %s: %w", policy.Resource, err)
+	}
+	return cookies, nil
+}
@@ -0,0 +1,126 @@
+package cdn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner("KTEST", path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// decodePolicy undoes CloudFront's URL-safe base64 variant.
+func decodePolicy(t *testing.T, s string) string {
+	t.Helper()
+	s = strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(s)
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSignURLWithPolicy(t *testing.T) {
+	signer := newTestSigner(t)
+	expires := time.Unix(2000000000, 0)
+	starts := time.Unix(1900000000, 0)
+
+	signed, err := signer.SignURLWithPolicy("https://cdn.example.com/videos/a.mp4", Policy{
+		Resource: "https://cdn.example.com/videos/*",
+		Expires:  expires,
+		Starts:   starts,
+		SourceIP: "192.0.2.0/24",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("Key-Pair-Id") != "KTEST" || q.Get("Signature") == "" {
+		t.Fatalf("signed URL %s is missing its key pair ID or signature", signed)
+	}
+	policy := decodePolicy(t, q.Get("Policy"))
+	for _, want := range []string{
+		`"Resource":"https://cdn.example.com/videos/*"`,
+		`"AWS:SourceIp":"192.0.2.0/24"`,
+		`"DateGreaterThan":{"AWS:EpochTime":1900000000}`,
+		`"DateLessThan":{"AWS:EpochTime":2000000000}`,
+	} {
+		if !strings.Contains(policy, want) {
+			t.Errorf("policy %s doesn't contain %s", policy, want)
+		}
+	}
+}
+
+func TestPolicyValidation(t *testing.T) {
+	signer := newTestSigner(t)
+	expires := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		policy Policy
+	}{
+		{"no resource", Policy{Expires: expires}},
+		{"starts after expiry", Policy{Resource: "https://cdn.example.com/*", Expires: expires, Starts: expires.Add(time.Minute)}},
+		{"not a range", Policy{Resource: "https://cdn.example.com/*", Expires: expires, SourceIP: "192.0.2.1"}},
+		{"IPv6 range", Policy{Resource: "https://cdn.example.com/*", Expires: expires, SourceIP: "2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := signer.SignURLWithPolicy("https://cdn.example.com/a.mp4", tt.policy); err == nil {
+				t.Error("expected an error")
+			}
+			if _, err := signer.SignCookies(tt.policy); err == nil {
+				t.Error("expected an error from SignCookies")
+			}
+		})
+	}
+}
+
+func TestSignCookies(t *testing.T) {
+	signer := newTestSigner(t)
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	cookies, err := signer.SignCookies(Policy{Resource: "https://cdn.example.com/videos/*", Expires: expires})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, c := range cookies {
+		names[c.Name] = true
+		if !c.Expires.Equal(expires) || !c.Secure {
+			t.Errorf("cookie %s expires %v, secure %v", c.Name, c.Expires, c.Secure)
+		}
+	}
+	for _, name := range []string{"CloudFront-Policy", "CloudFront-Signature", "CloudFront-Key-Pair-Id"} {
+		if !names[name] {
+			t.Errorf("missing cookie %s", name)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreateAPIKeyParams
+}
+
+type CreateAPIKeyParams struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Name    string    `json:"name"`
+	KeyHash string    `json:"-"`
+	// Prefix is the start of the key, shown so keys can be told apart.
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+const apiKeyColumns = `
+		id,
+		created_at,
+		updated_at,
+		user_id,
+		name,
+		key_hash,
+		prefix,
+		scopes,
+		expires_at,
+		last_used_at
+`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (APIKey, error) {
+	var key APIKey
+	var id, userID, scopes string
+	err := row.Scan(
+		&id,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+		&userID,
+		&key.Name,
+		&key.KeyHash,
+		&key.Prefix,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.ID, err = uuid.Parse(id)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.UserID, err = uuid.Parse(userID)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	return key, nil
+}
+
+func (c Client) CreateAPIKey(params CreateAPIKeyParams) (APIKey, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO api_keys (
+		id,
+		created_at,
+		updated_at,
+		user_id,
+		name,
+		key_hash,
+		prefix,
+		scopes,
+		expires_at
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+	`
+	var expiresAt *time.Time
+	if params.ExpiresAt != nil {
+		t := params.ExpiresAt.UTC()
+		expiresAt = &t
+	}
+	_, err := c.db.Exec(
+		query,
+		id.String(),
+		params.UserID.String(),
+		params.Name,
+		params.KeyHash,
+		params.Prefix,
+		strings.Join(params.Scopes, " "),
+		expiresAt,
+	)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return c.GetAPIKey(params.UserID, id)
+}
+
+// GetAPIKeys lists a user's keys that haven't been revoked, expired ones
+// included so the user can see why they stopped working.
+func (c Client) GetAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	FROM api_keys
+	WHERE user_id = ? AND revoked_at IS NULL
+	ORDER BY created_at
+	`
+	rows, err := c.db.Query(query, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKey returns one of a user's unrevoked keys.
+func (c Client) GetAPIKey(userID, id uuid.UUID) (APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	FROM api_keys
+	WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`
+	key, err := scanAPIKey(c.db.QueryRow(query, id.String(), userID.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, nil
+	}
+	return key, err
+}
+
+// GetActiveAPIKeyByHash finds the key with keyHash if it is neither revoked
+// nor expired, and records that it was used.
+func (c Client) GetActiveAPIKeyByHash(keyHash string) (APIKey, error) {
+	query := `
+	SELECT` + apiKeyColumns + `
+	FROM api_keys
+	WHERE key_hash = ?
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > ?)
+	`
+	key, err := scanAPIKey(c.db.QueryRow(query, keyHash, time.Now().UTC()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, nil
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	_, err = c.db.Exec(`UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?`, key.ID.String())
+	return key, err
+}
+
+// RenameAPIKey renames one of a user's keys, reporting whether it exists.
+func (c Client) RenameAPIKey(userID, id uuid.UUID, name string) (bool, error) {
+	query := `
+	UPDATE api_keys
+	SET name = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`
+	res, err := c.db.Exec(query, name, id.String(), userID.String())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeAPIKey revokes one of a user's keys, reporting whether it existed.
+func (c Client) RevokeAPIKey(userID, id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE api_keys
+	SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`
+	res, err := c.db.Exec(query, id.String(), userID.String())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -3,87 +3,163 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is go-sqlite3 with the SQL functions our queries need
+// registered on every connection.
+const sqliteDriver = "sqlite3_tubely"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("fts_rank", ftsRank, true)
+		},
+	})
+}
+
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite"
+	dialectPostgres dialect = "postgres"
 )
 
 type Client struct {
-	db *sql.DB
+	db *conn
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// NewClient opens the database without migrating it; call MigrateUp or
+// MigrateTo before using it. postgres:// and postgresql:// URLs select
+// PostgreSQL; anything else is a SQLite path or file: URI.
+func NewClient(dsn string) (Client, error) {
+	driver, d := sqliteDriver, dialectSQLite
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		driver, d = "postgres", dialectPostgres
+	} else {
+		dsn = strings.TrimPrefix(dsn, "sqlite://")
+	}
+
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	c := Client{&conn{DB: db, dialect: d}}
+	err = c.ensureMigrationsTable()
 	if err != nil {
 		return Client{}, err
 	}
+	if d == dialectSQLite {
+		err = c.adoptLegacySchema()
+		if err != nil {
+			return Client{}, fmt.Errorf("couldn't adopt existing schema: %w", err)
+		}
+	}
 	return c, nil
+}
 
+// conn and txn let queries be written once with ? placeholders, rewriting
+// them to $1, $2, ... for PostgreSQL.
+type conn struct {
+	*sql.DB
+	dialect dialect
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
-	if err != nil {
-		return err
-	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
+func (c *conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.DB.Exec(rebind(c.dialect, query), args...)
+}
+
+func (c *conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.DB.Query(rebind(c.dialect, query), args...)
+}
+
+func (c *conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.DB.QueryRow(rebind(c.dialect, query), args...)
+}
+
+func (c *conn) Begin() (*txn, error) {
+	tx, err := c.DB.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &txn{Tx: tx, dialect: c.dialect}, nil
+}
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
-	if err != nil {
-		return err
+type txn struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t *txn) Exec(query string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(rebind(t.dialect, query), args...)
+}
+
+func (t *txn) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(rebind(t.dialect, query), args...)
+}
+
+func (t *txn) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(rebind(t.dialect, query), args...)
+}
+
+// timeArg formats t for comparison with timestamps the database wrote itself
+// with CURRENT_TIMESTAMP, which SQLite stores as text in this layout.
+func (c Client) timeArg(t time.Time) any {
+	if c.db.dialect == dialectSQLite {
+		return t.UTC().Format("2006-01-02 15:04:05")
 	}
-	return nil
+	return t
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
-		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
+// rebind numbers ? placeholders for PostgreSQL, leaving string literals alone.
+func rebind(d dialect, query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
-		return fmt.Errorf("failed to reset table videos: %w", err)
+	return b.String()
+}
+
+// Reset empties every table, children before parents so it also works where
+// foreign keys are enforced.
+func (c Client) Reset() error {
+	for _, table := range []string{
+		"video_media",
+		"video_tags",
+		"tags",
+		"playlist_items",
+		"playlists",
+		"storage_tombstones",
+		"uploads",
+		"jobs",
+		"api_keys",
+		"refresh_tokens",
+		"videos",
+		"users",
+	} {
+		if _, err := c.db.Exec("DELETE FROM " + table); err != nil {
+			return fmt.Errorf("failed to reset table %s: %w", table, err)
+		}
 	}
 	return nil
 }
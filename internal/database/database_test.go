@@ -0,0 +1,83 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// forEachDialect runs test against a freshly migrated SQLite database and,
+// when TEST_DB_URL names one, a PostgreSQL database. Every test wipes that
+// database's schema, so it must be a scratch database.
+func forEachDialect(t *testing.T, test func(t *testing.T, c Client)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestClient(t, filepath.Join(t.TempDir(), "tubely.db")))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DB_URL")
+		if dsn == "" {
+			t.Skip("TEST_DB_URL isn't set")
+		}
+		test(t, newTestClient(t, dsn))
+	})
+}
+
+// newTestClient opens dsn and migrates it from scratch.
+func newTestClient(t *testing.T, dsn string) Client {
+	t.Helper()
+	c, err := NewClient(dsn)
+	if err != nil {
+		t.Fatalf("couldn't open database: %v", err)
+	}
+	t.Cleanup(func() { c.db.Close() })
+	if err := c.MigrateTo(0); err != nil {
+		t.Fatalf("couldn't empty database: %v", err)
+	}
+	if err := c.MigrateUp(); err != nil {
+		t.Fatalf("couldn't migrate database: %v", err)
+	}
+	return c
+}
+
+func createTestUser(t *testing.T, c Client, email string) User {
+	t.Helper()
+	user, err := c.CreateUser(CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatalf("couldn't create user: %v", err)
+	}
+	return *user
+}
+
+func createTestVideo(t *testing.T, c Client, userID uuid.UUID, title, description string, visibility Visibility) Video {
+	t.Helper()
+	video, err := c.CreateVideo(CreateVideoParams{
+		Title:       title,
+		Description: description,
+		Visibility:  visibility,
+		UserID:      userID,
+	})
+	if err != nil {
+		t.Fatalf("couldn't create video: %v", err)
+	}
+	return video
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		dialect dialect
+		query   string
+		want    string
+	}{
+		{dialectSQLite, `SELECT ? WHERE a = ?`, `SELECT ? WHERE a = ?`},
+		{dialectPostgres, `SELECT ? WHERE a = ?`, `SELECT $1 WHERE a = $2`},
+		{dialectPostgres, `SELECT '?' WHERE a = ?`, `SELECT '?' WHERE a = $1`},
+	}
+	for _, tt := range tests {
+		got := rebind(tt.dialect, tt.query)
+		if got != tt.want {
+			t.Errorf("rebind(%s, %q) = %q, want %q", tt.dialect, tt.query, got, tt.want)
+		}
+	}
+}
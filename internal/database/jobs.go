@@ -0,0 +1,338 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusDead      JobStatus = "dead"
+)
+
+// ErrJobLeaseLost is returned when a worker touches a job it no longer holds
+// the lease for, usually because the lease expired and another worker took it.
+var ErrJobLeaseLost = errors.New("job lease lost")
+
+type Job struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Status         JobStatus  `json:"status"`
+	Progress       int        `json:"progress"`
+	Attempts       int        `json:"attempts"`
+	LastError      *string    `json:"error"`
+	RunAt          time.Time  `json:"run_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	LeaseOwner     *string    `json:"-"`
+	LeaseExpiresAt *time.Time `json:"-"`
+	EnqueueJobParams
+}
+
+type EnqueueJobParams struct {
+	Type        string     `json:"type"`
+	UserID      uuid.UUID  `json:"user_id"`
+	VideoID     *uuid.UUID `json:"video_id"`
+	Payload     []byte     `json:"-"`
+	MaxAttempts int        `json:"max_attempts"`
+	// DedupeKey, when set, makes enqueueing idempotent: a second job with
+	// the same key isn't created and the first one is returned instead.
+	DedupeKey string `json:"-"`
+}
+
+const jobColumns = `
+	id,
+	created_at,
+	updated_at,
+	type,
+	status,
+	payload,
+	user_id,
+	video_id,
+	progress,
+	attempts,
+	max_attempts,
+	last_error,
+	run_at,
+	lease_owner,
+	lease_expires_at,
+	completed_at,
+	dedupe_key
+`
+
+func scanJob(row interface{ Scan(...any) error }) (Job, error) {
+	var job Job
+	var payload string
+	var dedupeKey sql.NullString
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.Type,
+		&job.Status,
+		&payload,
+		&job.UserID,
+		&job.VideoID,
+		&job.Progress,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.LastError,
+		&job.RunAt,
+		&job.LeaseOwner,
+		&job.LeaseExpiresAt,
+		&job.CompletedAt,
+		&dedupeKey,
+	)
+	if err != nil {
+		return Job{}, err
+	}
+	job.Payload = []byte(payload)
+	job.DedupeKey = dedupeKey.String
+	return job, nil
+}
+
+func (c Client) EnqueueJob(params EnqueueJobParams) (Job, error) {
+	id := uuid.New()
+	if params.MaxAttempts < 1 {
+		params.MaxAttempts = 1
+	}
+	query := `
+	INSERT INTO jobs (
+		id,
+		created_at,
+		updated_at,
+		type,
+		status,
+		payload,
+		user_id,
+		video_id,
+		max_attempts,
+		run_at,
+		dedupe_key
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (dedupe_key) DO NOTHING
+	`
+	var dedupeKey *string
+	if params.DedupeKey != "" {
+		dedupeKey = &params.DedupeKey
+	}
+	res, err := c.db.Exec(
+		query,
+		id,
+		params.Type,
+		JobStatusQueued,
+		string(params.Payload),
+		params.UserID,
+		params.VideoID,
+		params.MaxAttempts,
+		time.Now().UTC(),
+		dedupeKey,
+	)
+	if err != nil {
+		return Job{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Job{}, err
+	}
+	if n == 0 {
+		return c.GetJobByDedupeKey(params.DedupeKey)
+	}
+
+	return c.GetJob(id)
+}
+
+// GetJobByDedupeKey returns the job enqueued with key, or a zero Job if
+// there is none.
+func (c Client) GetJobByDedupeKey(key string) (Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE dedupe_key = ?`
+	job, err := scanJob(c.db.QueryRow(query, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+func (c Client) GetJob(id uuid.UUID) (Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ?`
+	job, err := scanJob(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// LeaseJob claims the oldest runnable job for workerID. Jobs whose lease has
+// expired are runnable again, so work survives a crashed worker. It returns
+// nil when there is nothing to do.
+func (c Client) LeaseJob(workerID string, leaseFor time.Duration) (*Job, error) {
+	now := time.Now().UTC()
+
+	// Jobs that keep losing their worker would otherwise be retried forever
+	_, err := c.db.Exec(`
+	UPDATE jobs
+	SET
+		status = ?,
+		last_error = 'lease expired',
+		lease_owner = NULL,
+		lease_expires_at = NULL,
+		completed_at = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE status = ? AND lease_expires_at < ? AND attempts >= max_attempts
+	`, JobStatusDead, now, JobStatusRunning, now)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		lease_owner = ?,
+		lease_expires_at = ?,
+		attempts = attempts + 1,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE (status = ? AND run_at <= ?) OR (status = ? AND lease_expires_at < ?)
+		ORDER BY run_at
+		LIMIT 1
+	) AND (status = ? OR lease_expires_at < ?)
+	RETURNING ` + jobColumns
+
+	job, err := scanJob(c.db.QueryRow(
+		query,
+		JobStatusRunning,
+		workerID,
+		now.Add(leaseFor),
+		JobStatusQueued,
+		now,
+		JobStatusRunning,
+		now,
+		JobStatusQueued,
+		now,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// HeartbeatJob extends the lease held by workerID and records progress.
+func (c Client) HeartbeatJob(id uuid.UUID, workerID string, leaseFor time.Duration, progress int) error {
+	query := `
+	UPDATE jobs
+	SET
+		lease_expires_at = ?,
+		progress = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.db.Exec(query, time.Now().UTC().Add(leaseFor), progress, id, JobStatusRunning, workerID)
+	if err != nil {
+		return err
+	}
+	return checkLeaseHeld(res)
+}
+
+func (c Client) CompleteJob(id uuid.UUID, workerID string) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		progress = 100,
+		last_error = NULL,
+		lease_owner = NULL,
+		lease_expires_at = NULL,
+		completed_at = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.db.Exec(query, JobStatusSucceeded, time.Now().UTC(), id, JobStatusRunning, workerID)
+	if err != nil {
+		return err
+	}
+	return checkLeaseHeld(res)
+}
+
+// FailJob records a failed attempt. The job is requeued to run after
+// retryAfter unless it is out of attempts or retry is false, in which case it
+// is dead-lettered.
+func (c Client) FailJob(id uuid.UUID, workerID string, jobErr string, retryAfter time.Duration, retry bool) error {
+	now := time.Now().UTC()
+	query := `
+	UPDATE jobs
+	SET
+		status = CASE WHEN ? AND attempts < max_attempts THEN ? ELSE ? END,
+		completed_at = CASE WHEN ? AND attempts < max_attempts THEN NULL ELSE CURRENT_TIMESTAMP END,
+		run_at = ?,
+		last_error = ?,
+		lease_owner = NULL,
+		lease_expires_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.db.Exec(
+		query,
+		retry,
+		JobStatusQueued,
+		JobStatusDead,
+		retry,
+		now.Add(retryAfter),
+		jobErr,
+		id,
+		JobStatusRunning,
+		workerID,
+	)
+	if err != nil {
+		return err
+	}
+	return checkLeaseHeld(res)
+}
+
+// ReleaseJob hands a job back to the queue without counting the attempt,
+// e.g. when the worker is shutting down.
+func (c Client) ReleaseJob(id uuid.UUID, workerID string) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		attempts = attempts - 1,
+		lease_owner = NULL,
+		lease_expires_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.db.Exec(query, JobStatusQueued, id, JobStatusRunning, workerID)
+	if err != nil {
+		return err
+	}
+	return checkLeaseHeld(res)
+}
+
+func checkLeaseHeld(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import "testing"
+
+func TestEnqueueJobDedupeKey(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "jobs@example.com")
+		video := createTestVideo(t, c, user.ID, "Title", "", VisibilityPublic)
+		params := EnqueueJobParams{
+			Type:      "process_video",
+			UserID:    user.ID,
+			VideoID:   &video.ID,
+			Payload:   []byte(`{}`),
+			DedupeKey: "direct-upload:abc",
+		}
+
+		first, err := c.EnqueueJob(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := c.EnqueueJob(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.ID != first.ID || second.DedupeKey != "direct-upload:abc" {
+			t.Errorf("second enqueue returned job %s, want %s", second.ID, first.ID)
+		}
+
+		found, err := c.GetJobByDedupeKey("direct-upload:abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.ID != first.ID {
+			t.Errorf("GetJobByDedupeKey returned %s, want %s", found.ID, first.ID)
+		}
+
+		// Jobs without a key never collide
+		params.DedupeKey = ""
+		a, err := c.EnqueueJob(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := c.EnqueueJob(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.ID == b.ID {
+			t.Error("jobs without a dedupe key were merged")
+		}
+	})
+}
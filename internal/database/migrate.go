@@ -0,0 +1,278 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations live in migrations/<dialect>/ as NNNN_name.up.sql and
+// NNNN_name.down.sql, with the same versions in every dialect. Each one runs
+// in a transaction together with its schema_migrations row, so a failed
+// migration leaves the schema where it was.
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaAhead is returned when the database was migrated by a newer binary.
+var ErrSchemaAhead = errors.New("database schema is newer than this binary")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(d))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", name)
+		}
+		versionStr, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s has no version number", name)
+		}
+		data, err := migrationFiles.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.Name, label, version)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, found %d at position %d", m.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestSchemaVersion is the version the embedded migrations lead to.
+func (c Client) LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+func (c Client) ensureMigrationsTable() error {
+	_, err := c.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	return err
+}
+
+// SchemaVersion returns the highest applied migration, or 0 for an empty
+// database.
+func (c Client) SchemaVersion() (int, error) {
+	var version sql.NullInt64
+	err := c.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// MigrateUp applies every pending migration.
+func (c Client) MigrateUp() error {
+	latest, err := c.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	return c.MigrateTo(latest)
+}
+
+// MigrateDown reverts the most recently applied migration.
+func (c Client) MigrateDown() error {
+	current, err := c.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return errors.New("no migrations to revert")
+	}
+	return c.MigrateTo(current - 1)
+}
+
+// MigrateTo applies or reverts migrations, one transaction each, until the
+// schema is at version.
+func (c Client) MigrateTo(version int) error {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return err
+	}
+	if version < 0 || version > len(migrations) {
+		return fmt.Errorf("unknown schema version %d, latest is %d", version, len(migrations))
+	}
+	current, err := c.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("%w: at version %d, latest known is %d", ErrSchemaAhead, current, len(migrations))
+	}
+
+	for current < version {
+		m := migrations[current]
+		err := c.applyMigration(m.Up, func(tx *txn) error {
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		current++
+	}
+	for current > version {
+		m := migrations[current-1]
+		err := c.applyMigration(m.Down, func(tx *txn) error {
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		current--
+	}
+	return nil
+}
+
+func (c Client) applyMigration(script string, record func(tx *txn) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(script)
+	if err != nil {
+		return err
+	}
+	err = record(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// adoptLegacySchema marks the baseline migration as applied on databases
+// created before migrations existed, after adding any columns that older
+// versions of the schema were missing.
+func (c Client) adoptLegacySchema() error {
+	var tables int
+	err := c.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'`).Scan(&tables)
+	if err != nil {
+		return err
+	}
+	version, err := c.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if tables == 0 || version > 0 {
+		return nil
+	}
+
+	baseline, err := loadMigrations(dialectSQLite)
+	if err != nil {
+		return err
+	}
+
+	// Tables added after the original schema were created with IF NOT EXISTS
+	// at startup, so any of them may be missing
+	script := strings.ReplaceAll(baseline[0].Up, "CREATE TABLE ", "CREATE TABLE IF NOT EXISTS ")
+	script = strings.ReplaceAll(script, "CREATE INDEX ", "CREATE INDEX IF NOT EXISTS ")
+	return c.applyMigration(script, func(tx *txn) error {
+		for _, col := range []struct{ column, definition string }{
+			{"hls_url", "TEXT"},
+			{"thumbnail_generated", "BOOLEAN NOT NULL DEFAULT FALSE"},
+			{"video_key", "TEXT"},
+			{"hls_key", "TEXT"},
+			{"visibility", "TEXT NOT NULL DEFAULT 'public'"},
+			{"thumbnail_key", "TEXT"},
+		} {
+			err := addColumnIfMissing(tx, "videos", col.column, col.definition)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, baseline[0].Version, baseline[0].Name)
+		return err
+	})
+}
+
+func addColumnIfMissing(tx *txn, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
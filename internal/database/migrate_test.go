@@ -0,0 +1,74 @@
+package database
+
+import "testing"
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	sqlite, err := loadMigrations(dialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgres, err := loadMigrations(dialectPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("sqlite has %d migrations, postgres has %d", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].Name != postgres[i].Name {
+			t.Errorf("migration %d is %s for sqlite but %s for postgres", i+1, sqlite[i].Name, postgres[i].Name)
+		}
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		latest, err := c.LatestSchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := createTestUser(t, c, "migrate@example.com")
+		createTestVideo(t, c, user.ID, "Survives", "", VisibilityPublic)
+
+		// Down to the baseline, which keeps users and videos, one step at a time
+		for version := latest; version > 1; version-- {
+			err := c.MigrateDown()
+			if err != nil {
+				t.Fatalf("reverting version %d: %v", version, err)
+			}
+			got, err := c.SchemaVersion()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != version-1 {
+				t.Fatalf("schema version = %d after reverting %d", got, version)
+			}
+		}
+
+		err = c.MigrateUp()
+		if err != nil {
+			t.Fatalf("migrating back up: %v", err)
+		}
+		got, err := c.SchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != latest {
+			t.Fatalf("schema version = %d, want %d", got, latest)
+		}
+
+	})
+}
+
+func TestMigrateToRejectsUnknownVersion(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		latest, err := c.LatestSchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.MigrateTo(latest + 1)
+		if err == nil {
+			t.Fatal("migrating past the latest version succeeded")
+		}
+	})
+}
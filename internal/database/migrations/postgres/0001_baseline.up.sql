@@ -0,0 +1,98 @@
+CREATE TABLE users (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMPTZ,
+	user_id UUID NOT NULL REFERENCES users(id),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE videos (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	thumbnail_generated BOOLEAN NOT NULL DEFAULT FALSE,
+	video_url TEXT,
+	hls_url TEXT,
+	video_key TEXT,
+	hls_key TEXT,
+	thumbnail_key TEXT,
+	visibility TEXT NOT NULL DEFAULT 'public',
+	user_id UUID NOT NULL REFERENCES users(id)
+);
+CREATE INDEX idx_videos_user_id ON videos(user_id);
+
+CREATE TABLE video_media (
+	video_id UUID PRIMARY KEY REFERENCES videos(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	container TEXT NOT NULL,
+	duration_seconds DOUBLE PRECISION NOT NULL,
+	bit_rate BIGINT NOT NULL,
+	size_bytes BIGINT NOT NULL,
+	video_codec TEXT NOT NULL,
+	audio_codec TEXT,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	frame_rate DOUBLE PRECISION NOT NULL,
+	rotation INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE uploads (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id),
+	video_id UUID NOT NULL,
+	upload_length BIGINT NOT NULL,
+	upload_offset BIGINT NOT NULL DEFAULT 0,
+	media_type TEXT NOT NULL,
+	metadata TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	completed_at TIMESTAMPTZ,
+	job_id UUID
+);
+CREATE INDEX idx_uploads_expires_at ON uploads(expires_at);
+
+CREATE TABLE jobs (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	type TEXT NOT NULL,
+	status TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id),
+	video_id UUID,
+	progress INTEGER NOT NULL DEFAULT 0,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	last_error TEXT,
+	run_at TIMESTAMPTZ NOT NULL,
+	lease_owner TEXT,
+	lease_expires_at TIMESTAMPTZ,
+	completed_at TIMESTAMPTZ
+);
+CREATE INDEX idx_jobs_status_run_at ON jobs(status, run_at);
+
+CREATE TABLE storage_tombstones (
+	id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	store TEXT NOT NULL,
+	key TEXT NOT NULL,
+	prefix BOOLEAN NOT NULL DEFAULT FALSE,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	run_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_storage_tombstones_run_at ON storage_tombstones(run_at);
@@ -0,0 +1,3 @@
+-- The Postgres baseline never had the SQLite column type quirks. This keeps
+-- version numbers in step across dialects.
+SELECT 1;
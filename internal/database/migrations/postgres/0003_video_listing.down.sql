@@ -0,0 +1,8 @@
+DROP INDEX idx_video_media_duration;
+DROP INDEX idx_videos_user_title;
+DROP INDEX idx_videos_user_updated;
+DROP INDEX idx_videos_user_created;
+CREATE INDEX idx_videos_user_id ON videos(user_id);
+
+DROP INDEX idx_video_media_aspect;
+ALTER TABLE video_media DROP COLUMN aspect;
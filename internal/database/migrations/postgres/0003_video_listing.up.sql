@@ -0,0 +1,21 @@
+-- Aspect category for filtering. Existing rows take it from the storage key
+-- prefix, which the processing job has always derived from the aspect ratio.
+ALTER TABLE video_media ADD COLUMN aspect TEXT;
+UPDATE video_media
+SET aspect = (
+	SELECT CASE
+		WHEN v.video_key LIKE 'landscape/%' THEN 'landscape'
+		WHEN v.video_key LIKE 'portrait/%' THEN 'portrait'
+		WHEN v.video_key IS NOT NULL THEN 'other'
+	END
+	FROM videos v
+	WHERE v.id = video_media.video_id
+);
+CREATE INDEX idx_video_media_aspect ON video_media(aspect);
+
+-- Keyset pagination walks these in both directions
+DROP INDEX idx_videos_user_id;
+CREATE INDEX idx_videos_user_created ON videos(user_id, created_at, id);
+CREATE INDEX idx_videos_user_updated ON videos(user_id, updated_at, id);
+CREATE INDEX idx_videos_user_title ON videos(user_id, title, id);
+CREATE INDEX idx_video_media_duration ON video_media(duration_seconds);
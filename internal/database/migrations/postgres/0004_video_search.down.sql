@@ -0,0 +1,2 @@
+DROP INDEX idx_videos_search;
+ALTER TABLE videos DROP COLUMN search;
@@ -0,0 +1,7 @@
+-- Titles outrank descriptions. A generated column stays in sync without
+-- triggers.
+ALTER TABLE videos ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(description, '')), 'B')
+) STORED;
+CREATE INDEX idx_videos_search ON videos USING GIN (search);
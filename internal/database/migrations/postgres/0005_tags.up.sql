@@ -0,0 +1,15 @@
+-- Tag names are stored normalized, so UNIQUE is enough to share one row
+-- between every video using the tag.
+CREATE TABLE tags (
+	id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE video_tags (
+	video_id UUID NOT NULL REFERENCES videos(id),
+	tag_id BIGINT NOT NULL REFERENCES tags(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (video_id, tag_id)
+);
+CREATE INDEX idx_video_tags_tag_id ON video_tags(tag_id, video_id);
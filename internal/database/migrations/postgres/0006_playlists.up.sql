@@ -0,0 +1,22 @@
+CREATE TABLE playlists (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	visibility TEXT NOT NULL DEFAULT 'public',
+	user_id UUID NOT NULL REFERENCES users(id)
+);
+CREATE INDEX idx_playlists_user_id ON playlists(user_id, created_at);
+
+-- Positions run from 0 without gaps. They aren't UNIQUE because shifting a
+-- range of items one at a time would collide halfway through.
+CREATE TABLE playlist_items (
+	playlist_id UUID NOT NULL REFERENCES playlists(id),
+	video_id UUID NOT NULL REFERENCES videos(id),
+	position INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (playlist_id, video_id)
+);
+CREATE INDEX idx_playlist_items_position ON playlist_items(playlist_id, position);
+CREATE INDEX idx_playlist_items_video_id ON playlist_items(video_id);
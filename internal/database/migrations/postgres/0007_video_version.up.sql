@@ -0,0 +1,3 @@
+-- Bumped on every update and used as the video's ETag. updated_at alone only
+-- has one-second resolution in SQLite.
+ALTER TABLE videos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
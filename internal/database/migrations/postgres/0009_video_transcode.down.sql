@@ -0,0 +1,7 @@
+ALTER TABLE video_media DROP COLUMN source_audio_codec;
+ALTER TABLE video_media DROP COLUMN source_video_codec;
+ALTER TABLE video_media DROP COLUMN source_type;
+ALTER TABLE video_media DROP COLUMN transcode_audio_bitrate;
+ALTER TABLE video_media DROP COLUMN transcode_max_resolution;
+ALTER TABLE video_media DROP COLUMN transcode_preset;
+ALTER TABLE video_media DROP COLUMN transcode_crf;
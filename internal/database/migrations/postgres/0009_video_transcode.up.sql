@@ -0,0 +1,9 @@
+-- Set when the upload was transcoded before storing, recording the profile
+-- used and what the upload was to begin with.
+ALTER TABLE video_media ADD COLUMN transcode_crf INTEGER;
+ALTER TABLE video_media ADD COLUMN transcode_preset TEXT;
+ALTER TABLE video_media ADD COLUMN transcode_max_resolution INTEGER;
+ALTER TABLE video_media ADD COLUMN transcode_audio_bitrate TEXT;
+ALTER TABLE video_media ADD COLUMN source_type TEXT;
+ALTER TABLE video_media ADD COLUMN source_video_codec TEXT;
+ALTER TABLE video_media ADD COLUMN source_audio_codec TEXT;
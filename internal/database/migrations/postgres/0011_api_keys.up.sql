@@ -0,0 +1,16 @@
+-- Personal API keys. Only a SHA-256 hash of the key is kept; prefix is the
+-- start of the key so users can tell their keys apart.
+CREATE TABLE api_keys (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	key_hash TEXT UNIQUE NOT NULL,
+	prefix TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id, created_at);
@@ -0,0 +1,6 @@
+-- Refresh tokens rotate on every use. Each login starts a family that all of
+-- its replacements share, so reuse of a rotated token can revoke them all.
+ALTER TABLE refresh_tokens ADD COLUMN family_id UUID;
+UPDATE refresh_tokens SET family_id = gen_random_uuid();
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
@@ -0,0 +1,11 @@
+-- A refresh token family is a login session. Its tokens remember when the
+-- session began and where it was last used from, so users can recognise it.
+ALTER TABLE refresh_tokens ADD COLUMN logged_in_at TIMESTAMPTZ;
+UPDATE refresh_tokens SET logged_in_at = (
+	SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id
+);
+ALTER TABLE refresh_tokens ALTER COLUMN logged_in_at SET NOT NULL;
+ALTER TABLE refresh_tokens ADD COLUMN last_used_at TIMESTAMPTZ;
+ALTER TABLE refresh_tokens ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
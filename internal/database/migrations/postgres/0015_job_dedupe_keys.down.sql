@@ -0,0 +1,2 @@
+DROP INDEX idx_jobs_dedupe_key;
+ALTER TABLE jobs DROP COLUMN dedupe_key;
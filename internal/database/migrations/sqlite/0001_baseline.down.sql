@@ -0,0 +1,7 @@
+DROP TABLE storage_tombstones;
+DROP TABLE jobs;
+DROP TABLE uploads;
+DROP TABLE video_media;
+DROP TABLE videos;
+DROP TABLE refresh_tokens;
+DROP TABLE users;
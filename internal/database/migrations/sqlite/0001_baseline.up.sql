@@ -0,0 +1,103 @@
+-- Schema as it stood before versioned migrations, quirks included.
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	thumbnail_generated BOOLEAN NOT NULL DEFAULT FALSE,
+	video_url TEXT TEXT,
+	hls_url TEXT,
+	video_key TEXT,
+	hls_key TEXT,
+	visibility TEXT NOT NULL DEFAULT 'public',
+	thumbnail_key TEXT,
+	user_id INTEGER,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+CREATE TABLE video_media (
+	video_id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	container TEXT NOT NULL,
+	duration_seconds REAL NOT NULL,
+	bit_rate INTEGER NOT NULL,
+	size_bytes INTEGER NOT NULL,
+	video_codec TEXT NOT NULL,
+	audio_codec TEXT,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	frame_rate REAL NOT NULL,
+	rotation INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+CREATE TABLE uploads (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	upload_length INTEGER NOT NULL,
+	upload_offset INTEGER NOT NULL DEFAULT 0,
+	media_type TEXT NOT NULL,
+	metadata TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	completed_at TIMESTAMP,
+	job_id TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_uploads_expires_at ON uploads(expires_at);
+
+CREATE TABLE jobs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	type TEXT NOT NULL,
+	status TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	video_id TEXT,
+	progress INTEGER NOT NULL DEFAULT 0,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	last_error TEXT,
+	run_at TIMESTAMP NOT NULL,
+	lease_owner TEXT,
+	lease_expires_at TIMESTAMP,
+	completed_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_jobs_status_run_at ON jobs(status, run_at);
+
+CREATE TABLE storage_tombstones (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	store TEXT NOT NULL,
+	key TEXT NOT NULL,
+	prefix BOOLEAN NOT NULL DEFAULT FALSE,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT,
+	run_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_storage_tombstones_run_at ON storage_tombstones(run_at);
@@ -0,0 +1,31 @@
+CREATE TABLE videos_old (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	thumbnail_generated BOOLEAN NOT NULL DEFAULT FALSE,
+	video_url TEXT TEXT,
+	hls_url TEXT,
+	video_key TEXT,
+	hls_key TEXT,
+	visibility TEXT NOT NULL DEFAULT 'public',
+	thumbnail_key TEXT,
+	user_id INTEGER,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_old (
+	id, created_at, updated_at, title, description, thumbnail_url,
+	thumbnail_generated, video_url, hls_url, video_key, hls_key,
+	thumbnail_key, visibility, user_id
+)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url,
+	thumbnail_generated, video_url, hls_url, video_key, hls_key,
+	thumbnail_key, visibility, user_id
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_old RENAME TO videos;
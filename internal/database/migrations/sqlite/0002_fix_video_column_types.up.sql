@@ -0,0 +1,34 @@
+-- video_url was declared TEXT TEXT and user_id INTEGER although it holds a
+-- UUID. SQLite can't alter column types, so the table is rebuilt.
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	thumbnail_generated BOOLEAN NOT NULL DEFAULT FALSE,
+	video_url TEXT,
+	hls_url TEXT,
+	video_key TEXT,
+	hls_key TEXT,
+	thumbnail_key TEXT,
+	visibility TEXT NOT NULL DEFAULT 'public',
+	user_id TEXT NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_new (
+	id, created_at, updated_at, title, description, thumbnail_url,
+	thumbnail_generated, video_url, hls_url, video_key, hls_key,
+	thumbnail_key, visibility, user_id
+)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url,
+	thumbnail_generated, video_url, hls_url, video_key, hls_key,
+	thumbnail_key, visibility, user_id
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+CREATE INDEX idx_videos_user_id ON videos(user_id);
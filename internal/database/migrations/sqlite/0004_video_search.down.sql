@@ -0,0 +1,5 @@
+DROP TRIGGER videos_fts_update;
+DROP TRIGGER videos_fts_delete;
+DROP TRIGGER videos_fts_insert;
+DROP TABLE videos_fts;
+DROP TABLE video_search_docids;
@@ -0,0 +1,44 @@
+-- FTS4 ships with go-sqlite3's default build. videos has a TEXT primary key,
+-- so its rowids can change on VACUUM; video_search_docids hands out stable
+-- docids instead, which the triggers use to reach a video's FTS row without
+-- a scan.
+CREATE TABLE video_search_docids (
+	docid INTEGER PRIMARY KEY,
+	video_id TEXT NOT NULL UNIQUE
+);
+
+CREATE VIRTUAL TABLE videos_fts USING fts4(
+	title,
+	description,
+	tokenize = porter
+);
+
+INSERT INTO video_search_docids (video_id)
+SELECT id FROM videos;
+
+INSERT INTO videos_fts (docid, title, description)
+SELECT d.docid, v.title, COALESCE(v.description, '')
+FROM videos v
+JOIN video_search_docids d ON d.video_id = v.id;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO video_search_docids (video_id) VALUES (new.id);
+	INSERT INTO videos_fts (docid, title, description)
+	VALUES (
+		(SELECT docid FROM video_search_docids WHERE video_id = new.id),
+		new.title,
+		COALESCE(new.description, '')
+	);
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts
+	WHERE docid = (SELECT docid FROM video_search_docids WHERE video_id = old.id);
+	DELETE FROM video_search_docids WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos BEGIN
+	UPDATE videos_fts
+	SET title = new.title, description = COALESCE(new.description, '')
+	WHERE docid = (SELECT docid FROM video_search_docids WHERE video_id = new.id);
+END;
@@ -0,0 +1,17 @@
+-- Tag names are stored normalized, so UNIQUE is enough to share one row
+-- between every video using the tag.
+CREATE TABLE tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE video_tags (
+	video_id TEXT NOT NULL,
+	tag_id INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (video_id, tag_id),
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(tag_id) REFERENCES tags(id)
+);
+CREATE INDEX idx_video_tags_tag_id ON video_tags(tag_id, video_id);
@@ -0,0 +1,25 @@
+CREATE TABLE playlists (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	visibility TEXT NOT NULL DEFAULT 'public',
+	user_id TEXT NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_playlists_user_id ON playlists(user_id, created_at);
+
+-- Positions run from 0 without gaps. They aren't UNIQUE because shifting a
+-- range of items one at a time would collide halfway through.
+CREATE TABLE playlist_items (
+	playlist_id TEXT NOT NULL,
+	video_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (playlist_id, video_id),
+	FOREIGN KEY(playlist_id) REFERENCES playlists(id),
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+CREATE INDEX idx_playlist_items_position ON playlist_items(playlist_id, position);
+CREATE INDEX idx_playlist_items_video_id ON playlist_items(video_id);
@@ -0,0 +1,3 @@
+-- JSON array of the resized copies of the thumbnail. thumbnail_url and
+-- thumbnail_key keep pointing at the largest one.
+ALTER TABLE videos ADD COLUMN thumbnail_renditions TEXT;
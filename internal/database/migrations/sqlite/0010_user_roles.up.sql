@@ -0,0 +1,4 @@
+-- One of user, moderator or admin; see auth.Role
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+-- Disabled users can't log in or use their tokens
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
@@ -0,0 +1,17 @@
+-- Personal API keys. Only a SHA-256 hash of the key is kept; prefix is the
+-- start of the key so users can tell their keys apart.
+CREATE TABLE api_keys (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	key_hash TEXT UNIQUE NOT NULL,
+	prefix TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id, created_at);
@@ -0,0 +1,8 @@
+-- Refresh tokens rotate on every use. Each login starts a family that all of
+-- its replacements share, so reuse of a rotated token can revoke them all.
+ALTER TABLE refresh_tokens ADD COLUMN family_id TEXT;
+UPDATE refresh_tokens SET family_id = lower(
+	hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' ||
+	hex(randomblob(2)) || '-' || hex(randomblob(6))
+);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
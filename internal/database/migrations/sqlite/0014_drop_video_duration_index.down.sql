@@ -0,0 +1 @@
+CREATE INDEX idx_video_media_duration ON video_media(duration_seconds);
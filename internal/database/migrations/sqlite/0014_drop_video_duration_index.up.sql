@@ -0,0 +1,3 @@
+-- The duration sort orders by COALESCE(duration_seconds, -1), which this
+-- index can't serve.
+DROP INDEX idx_video_media_duration;
@@ -0,0 +1,4 @@
+-- Enqueueing a job with a dedupe key that's already taken returns the
+-- existing job, so retried requests don't queue the same work twice.
+ALTER TABLE jobs ADD COLUMN dedupe_key TEXT;
+CREATE UNIQUE INDEX idx_jobs_dedupe_key ON jobs(dedupe_key);
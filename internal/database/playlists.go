@@ -0,0 +1,391 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPlaylistItemExists   = errors.New("video is already in the playlist")
+	ErrPlaylistItemNotFound = errors.New("video isn't in the playlist")
+	ErrInvalidPosition      = errors.New("position is out of range")
+	// ErrReorderMismatch is returned when a new order doesn't list exactly
+	// the playlist's current videos.
+	ErrReorderMismatch = errors.New("order must list every video in the playlist exactly once")
+)
+
+type Playlist struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ItemCount int       `json:"item_count"`
+	CreatePlaylistParams
+}
+
+type CreatePlaylistParams struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Visibility  Visibility `json:"visibility"`
+	UserID      uuid.UUID  `json:"user_id"`
+}
+
+type PlaylistItem struct {
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Video    Video     `json:"video"`
+}
+
+const playlistColumns = `
+		p.id,
+		p.created_at,
+		p.updated_at,
+		p.title,
+		p.description,
+		p.visibility,
+		p.user_id,
+		(SELECT COUNT(*) FROM playlist_items pi WHERE pi.playlist_id = p.id)
+`
+
+func scanPlaylist(row interface{ Scan(...any) error }) (Playlist, error) {
+	var p Playlist
+	err := row.Scan(
+		&p.ID,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&p.Title,
+		&p.Description,
+		&p.Visibility,
+		&p.UserID,
+		&p.ItemCount,
+	)
+	return p, err
+}
+
+func (c Client) CreatePlaylist(params CreatePlaylistParams) (Playlist, error) {
+	id := uuid.New()
+	if params.Visibility == "" {
+		params.Visibility = VisibilityPublic
+	}
+	_, err := c.db.Exec(`
+	INSERT INTO playlists (id, created_at, updated_at, title, description, visibility, user_id)
+	VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`, id, params.Title, params.Description, params.Visibility, params.UserID)
+	if err != nil {
+		return Playlist{}, err
+	}
+	return c.GetPlaylist(id)
+}
+
+// GetPlaylist returns a zero Playlist if it doesn't exist.
+func (c Client) GetPlaylist(id uuid.UUID) (Playlist, error) {
+	p, err := scanPlaylist(c.db.QueryRow(`
+	SELECT`+playlistColumns+`
+	FROM playlists p
+	WHERE p.id = ?
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Playlist{}, nil
+	}
+	return p, err
+}
+
+// GetPlaylists returns a user's playlists, newest first.
+func (c Client) GetPlaylists(userID uuid.UUID) ([]Playlist, error) {
+	rows, err := c.db.Query(`
+	SELECT`+playlistColumns+`
+	FROM playlists p
+	WHERE p.user_id = ?
+	ORDER BY p.created_at DESC, p.id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		p, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, p)
+	}
+	return playlists, rows.Err()
+}
+
+// GetPlaylistItems returns a playlist's videos in order.
+func (c Client) GetPlaylistItems(playlistID uuid.UUID) ([]PlaylistItem, error) {
+	rows, err := c.db.Query(`
+	SELECT`+videoColumns+`,
+		pi.position,
+		pi.created_at
+	FROM playlist_items pi
+	JOIN videos v ON v.id = pi.video_id
+	LEFT JOIN video_media m ON m.video_id = v.id
+	WHERE pi.playlist_id = ?
+	ORDER BY pi.position
+	`, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []PlaylistItem{}
+	for rows.Next() {
+		var item PlaylistItem
+		item.Video, err = scanVideo(withExtraColumns{rows, []any{&item.Position, &item.AddedAt}})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// UpdatePlaylist saves a playlist's title, description and visibility.
+func (c Client) UpdatePlaylist(p Playlist) error {
+	_, err := c.db.Exec(`
+	UPDATE playlists
+	SET
+		title = ?,
+		description = ?,
+		visibility = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`, p.Title, p.Description, p.Visibility, p.ID)
+	return err
+}
+
+func (c Client) DeletePlaylist(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM playlist_items WHERE playlist_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM playlists WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// beginPlaylistChange starts a transaction that changes a playlist's items.
+// Bumping updated_at first takes the playlist's write lock, so concurrent
+// changes to the same playlist run one after the other.
+func (c Client) beginPlaylistChange(id uuid.UUID) (*txn, int, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	res, err := tx.Exec(`UPDATE playlists SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	if err == nil {
+		var n int64
+		n, err = res.RowsAffected()
+		if err == nil && n == 0 {
+			err = sql.ErrNoRows
+		}
+	}
+	var count int
+	if err == nil {
+		err = tx.QueryRow(`SELECT COUNT(*) FROM playlist_items WHERE playlist_id = ?`, id).Scan(&count)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+	return tx, count, nil
+}
+
+func playlistItemPosition(tx *txn, playlistID, videoID uuid.UUID) (int, error) {
+	var position int
+	err := tx.QueryRow(
+		`SELECT position FROM playlist_items WHERE playlist_id = ? AND video_id = ?`, playlistID, videoID,
+	).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrPlaylistItemNotFound
+	}
+	return position, err
+}
+
+// AddPlaylistItem inserts a video at position, moving later items down, or
+// appends it when position is nil.
+func (c Client) AddPlaylistItem(playlistID, videoID uuid.UUID, position *int) error {
+	tx, count, err := c.beginPlaylistChange(playlistID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = playlistItemPosition(tx, playlistID, videoID)
+	if err == nil {
+		return ErrPlaylistItemExists
+	}
+	if !errors.Is(err, ErrPlaylistItemNotFound) {
+		return err
+	}
+
+	pos := count
+	if position != nil {
+		pos = *position
+	}
+	if pos < 0 || pos > count {
+		return ErrInvalidPosition
+	}
+
+	_, err = tx.Exec(`
+	UPDATE playlist_items SET position = position + 1
+	WHERE playlist_id = ? AND position >= ?
+	`, playlistID, pos)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	INSERT INTO playlist_items (playlist_id, video_id, position, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`, playlistID, videoID, pos)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemovePlaylistItem takes a video out of a playlist, closing the gap.
+func (c Client) RemovePlaylistItem(playlistID, videoID uuid.UUID) error {
+	tx, _, err := c.beginPlaylistChange(playlistID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pos, err := playlistItemPosition(tx, playlistID, videoID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM playlist_items WHERE playlist_id = ? AND video_id = ?`, playlistID, videoID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	UPDATE playlist_items SET position = position - 1
+	WHERE playlist_id = ? AND position > ?
+	`, playlistID, pos)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MovePlaylistItem moves a video to position, shifting the items in between
+// by one.
+func (c Client) MovePlaylistItem(playlistID, videoID uuid.UUID, position int) error {
+	tx, count, err := c.beginPlaylistChange(playlistID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	from, err := playlistItemPosition(tx, playlistID, videoID)
+	if err != nil {
+		return err
+	}
+	if position < 0 || position >= count {
+		return ErrInvalidPosition
+	}
+
+	if position < from {
+		_, err = tx.Exec(`
+		UPDATE playlist_items SET position = position + 1
+		WHERE playlist_id = ? AND position >= ? AND position < ?
+		`, playlistID, position, from)
+	} else {
+		_, err = tx.Exec(`
+		UPDATE playlist_items SET position = position - 1
+		WHERE playlist_id = ? AND position > ? AND position <= ?
+		`, playlistID, from, position)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	UPDATE playlist_items SET position = ?
+	WHERE playlist_id = ? AND video_id = ?
+	`, position, playlistID, videoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReorderPlaylist puts a playlist's videos in the given order, which must
+// contain each of them exactly once.
+func (c Client) ReorderPlaylist(playlistID uuid.UUID, videoIDs []uuid.UUID) error {
+	tx, count, err := c.beginPlaylistChange(playlistID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(videoIDs) != count {
+		return ErrReorderMismatch
+	}
+	seen := map[uuid.UUID]bool{}
+	for i, id := range videoIDs {
+		if seen[id] {
+			return ErrReorderMismatch
+		}
+		seen[id] = true
+
+		res, err := tx.Exec(`
+		UPDATE playlist_items SET position = ?
+		WHERE playlist_id = ? AND video_id = ?
+		`, i, playlistID, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrReorderMismatch
+		}
+	}
+	return tx.Commit()
+}
+
+// removeVideoFromPlaylists drops a video from every playlist containing it,
+// closing the gaps it leaves.
+func removeVideoFromPlaylists(tx *txn, videoID uuid.UUID) error {
+	// Touch the playlists first so locks are taken in the same order as
+	// beginPlaylistChange
+	_, err := tx.Exec(`
+	UPDATE playlists SET updated_at = CURRENT_TIMESTAMP
+	WHERE id IN (SELECT playlist_id FROM playlist_items WHERE video_id = ?)
+	`, videoID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	UPDATE playlist_items
+	SET position = position - 1
+	WHERE EXISTS (
+		SELECT 1 FROM playlist_items removed
+		WHERE removed.playlist_id = playlist_items.playlist_id
+			AND removed.video_id = ?
+			AND removed.position < playlist_items.position
+	)
+	`, videoID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM playlist_items WHERE video_id = ?`, videoID)
+	return err
+}
@@ -2,47 +2,191 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrRefreshTokenReused is returned when a refresh token that was already
+// rotated or revoked is presented again. Its whole family is revoked, since
+// either the client or someone who stole the token is replaying it.
+var ErrRefreshTokenReused = errors.New("refresh token was already used")
+
 type RefreshToken struct {
 	CreateRefreshTokenParams
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	RevokedAt *time.Time `json:"revoked_at"`
+	// LoggedInAt is when the family's first token was issued.
+	LoggedInAt time.Time  `json:"logged_in_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
 
 type CreateRefreshTokenParams struct {
-	Token     string    `json:"token"`
-	UserID    uuid.UUID `json:"user_id"`
+	Token  string    `json:"token"`
+	UserID uuid.UUID `json:"user_id"`
+	// FamilyID is shared by a token and every token it's rotated into. A new
+	// family is started when it's left unset.
+	FamilyID  uuid.UUID `json:"family_id"`
 	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+}
+
+const refreshTokenColumns = `
+		token,
+		created_at,
+		updated_at,
+		user_id,
+		family_id,
+		expires_at,
+		revoked_at,
+		logged_in_at,
+		last_used_at,
+		user_agent,
+		ip_address
+`
+
+func scanRefreshToken(row interface{ Scan(...any) error }) (RefreshToken, error) {
+	var rt RefreshToken
+	var userID, familyID string
+	err := row.Scan(
+		&rt.Token,
+		&rt.CreatedAt,
+		&rt.UpdatedAt,
+		&userID,
+		&familyID,
+		&rt.ExpiresAt,
+		&rt.RevokedAt,
+		&rt.LoggedInAt,
+		&rt.LastUsedAt,
+		&rt.UserAgent,
+		&rt.IPAddress,
+	)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	rt.UserID, err = uuid.Parse(userID)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	rt.FamilyID, err = uuid.Parse(familyID)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	return rt, nil
 }
 
 func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+	if params.FamilyID == uuid.Nil {
+		params.FamilyID = uuid.New()
+	}
+	err := insertRefreshToken(c.db, params, time.Now().UTC())
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	return c.GetRefreshToken(params.Token)
+}
+
+func insertRefreshToken(db execer, params CreateRefreshTokenParams, loggedInAt time.Time) error {
 	query := `
 		INSERT INTO refresh_tokens (
 			token,
 			created_at,
 			updated_at,
 			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+			family_id,
+			expires_at,
+			logged_in_at,
+			last_used_at,
+			user_agent,
+			ip_address
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	_, err := db.Exec(
+		query,
+		params.Token,
+		params.UserID.String(),
+		params.FamilyID.String(),
+		params.ExpiresAt.UTC(),
+		loggedInAt.UTC(),
+		params.UserAgent,
+		params.IPAddress,
+	)
+	return err
+}
+
+// RotateRefreshToken revokes token and replaces it with the one described by
+// params, in the same family and for the same user. A token that is unknown
+// or expired gives a zero RefreshToken; one that was already revoked gives
+// ErrRefreshTokenReused after revoking the rest of its family.
+func (c Client) RotateRefreshToken(token string, params CreateRefreshTokenParams) (RefreshToken, error) {
+	tx, err := c.db.Begin()
 	if err != nil {
 		return RefreshToken{}, err
 	}
+	defer tx.Rollback()
 
+	old, err := scanRefreshToken(tx.QueryRow(`SELECT`+refreshTokenColumns+`FROM refresh_tokens WHERE token = ?`, token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, nil
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if old.RevokedAt != nil {
+		_, err = tx.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE family_id = ? AND revoked_at IS NULL
+		`, old.FamilyID.String())
+		if err != nil {
+			return RefreshToken{}, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return RefreshToken{}, err
+		}
+		return RefreshToken{}, ErrRefreshTokenReused
+	}
+
+	// Guarded again so a concurrent rotation can't also succeed
+	res, err := tx.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE token = ? AND revoked_at IS NULL AND expires_at > ?
+	`, token, time.Now().UTC())
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return RefreshToken{}, err
+	}
+
+	params.UserID = old.UserID
+	params.FamilyID = old.FamilyID
+	err = insertRefreshToken(tx, params, old.LoggedInAt)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return RefreshToken{}, err
+	}
 	return c.GetRefreshToken(params.Token)
 }
 
+// RevokeRefreshToken ends the session token belongs to, revoking its whole
+// family.
 func (c Client) RevokeRefreshToken(token string) error {
 	query := `
 		UPDATE refresh_tokens
-		SET revoked_at = CURRENT_TIMESTAMP
-		WHERE token = ?
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token = ?)
+			AND revoked_at IS NULL
 	`
 	_, err := c.db.Exec(query, token)
 	return err
@@ -50,27 +194,15 @@ func (c Client) RevokeRefreshToken(token string) error {
 
 func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT` + refreshTokenColumns + `
 		FROM refresh_tokens
 		WHERE token = ?
 	`
-	var rt RefreshToken
-	var userID string
-	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return RefreshToken{}, nil
-		}
-		return RefreshToken{}, err
+	rt, err := scanRefreshToken(c.db.QueryRow(query, token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RefreshToken{}, nil
 	}
-
-	rt.UserID, err = uuid.Parse(userID)
-	if err != nil {
-		return RefreshToken{}, err
-	}
-
-	return rt, nil
+	return rt, err
 }
 
 func (c Client) DeleteRefreshToken(token string) error {
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func createTestRefreshToken(t *testing.T, c Client, userID uuid.UUID, token string) RefreshToken {
+	t.Helper()
+	rt, err := c.CreateRefreshToken(CreateRefreshTokenParams{
+		Token:     token,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("couldn't create refresh token: %v", err)
+	}
+	return rt
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "rotate@example.com")
+		first := createTestRefreshToken(t, c, user.ID, "first")
+		if first.FamilyID == uuid.Nil {
+			t.Fatal("new token has no family")
+		}
+
+		second, err := c.RotateRefreshToken("first", CreateRefreshTokenParams{
+			Token:     "second",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if second.UserID != user.ID || second.FamilyID != first.FamilyID {
+			t.Errorf("rotated token belongs to %s/%s, want %s/%s", second.UserID, second.FamilyID, user.ID, first.FamilyID)
+		}
+		old, err := c.GetRefreshToken("first")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if old.RevokedAt == nil {
+			t.Error("rotated token wasn't revoked")
+		}
+
+		// Replaying the old token ends the whole family
+		_, err = c.RotateRefreshToken("first", CreateRefreshTokenParams{
+			Token:     "third",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("reusing a token gave %v, want ErrRefreshTokenReused", err)
+		}
+		owner, err := c.GetUserByRefreshToken("second")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owner != nil {
+			t.Error("the family's newest token survived a replay")
+		}
+	})
+}
+
+func TestRotateUnknownOrExpiredRefreshToken(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "expired@example.com")
+		_, err := c.CreateRefreshToken(CreateRefreshTokenParams{
+			Token:     "expired",
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, token := range []string{"unknown", "expired"} {
+			rt, err := c.RotateRefreshToken(token, CreateRefreshTokenParams{
+				Token:     token + "-next",
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			if err != nil || rt.Token != "" {
+				t.Errorf("rotating %s token = %+v, %v; want zero token", token, rt, err)
+			}
+		}
+	})
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "revoke@example.com")
+		createTestRefreshToken(t, c, user.ID, "keep")
+		createTestRefreshToken(t, c, user.ID, "revoke")
+
+		err := c.RevokeRefreshToken("revoke")
+		if err != nil {
+			t.Fatal(err)
+		}
+		revoked, err := c.GetRefreshToken("revoke")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked.RevokedAt == nil {
+			t.Error("token wasn't revoked")
+		}
+		kept, err := c.GetRefreshToken("keep")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept.RevokedAt != nil {
+			t.Error("revoking one session ended another")
+		}
+	})
+}
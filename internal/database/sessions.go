@@ -0,0 +1,93 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login: a refresh token family, described by its one token
+// that is neither revoked nor expired. Its ID is the family ID, which access
+// tokens carry as their sid claim.
+type Session struct {
+	ID         uuid.UUID  `json:"id"`
+	LoggedInAt time.Time  `json:"logged_in_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+}
+
+// GetSessions lists a user's active sessions, most recently used first.
+func (c Client) GetSessions(userID uuid.UUID) ([]Session, error) {
+	query := `
+	SELECT family_id, logged_in_at, last_used_at, expires_at, user_agent, ip_address
+	FROM refresh_tokens
+	WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+	ORDER BY last_used_at DESC
+	`
+	rows, err := c.db.Query(query, userID.String(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var id string
+		err := rows.Scan(&id, &s.LoggedInAt, &s.LastUsedAt, &s.ExpiresAt, &s.UserAgent, &s.IPAddress)
+		if err != nil {
+			return nil, err
+		}
+		s.ID, err = uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records that one of a user's sessions was used, reporting
+// whether it is still active.
+func (c Client) TouchSession(userID, id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE refresh_tokens
+	SET last_used_at = CURRENT_TIMESTAMP
+	WHERE family_id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?
+	`
+	res, err := c.db.Exec(query, id.String(), userID.String(), time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeSession ends one of a user's sessions, reporting whether it had
+// anything left to revoke.
+func (c Client) RevokeSession(userID, id uuid.UUID) (bool, error) {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE family_id = ? AND user_id = ? AND revoked_at IS NULL
+	`
+	res, err := c.db.Exec(query, id.String(), userID.String())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeOtherSessions ends every one of a user's sessions except keep.
+func (c Client) RevokeOtherSessions(userID, keep uuid.UUID) error {
+	query := `
+	UPDATE refresh_tokens
+	SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+	WHERE user_id = ? AND family_id <> ? AND revoked_at IS NULL
+	`
+	_, err := c.db.Exec(query, userID.String(), keep.String())
+	return err
+}
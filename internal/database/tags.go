@@ -0,0 +1,214 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxTagsPerVideo = 20
+	MaxTagLength    = 32
+)
+
+var (
+	ErrInvalidTag  = fmt.Errorf("tags must be 1 to %d letters, digits, spaces, '-' or '_'", MaxTagLength)
+	ErrTooManyTags = fmt.Errorf("a video can have at most %d tags", MaxTagsPerVideo)
+)
+
+type TagSuggestion struct {
+	Name string `json:"name"`
+	// Videos is how many videos visible to the user carry the tag.
+	Videos int `json:"videos"`
+}
+
+// NormalizeTagName case-folds a tag and collapses its whitespace, so "Cats",
+// " cats" and "CATS " are the same tag.
+func NormalizeTagName(name string) (string, error) {
+	name = strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if name == "" || utf8.RuneCountInString(name) > MaxTagLength {
+		return "", ErrInvalidTag
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != ' ' && r != '-' && r != '_' {
+			return "", ErrInvalidTag
+		}
+	}
+	return name, nil
+}
+
+func normalizeTagNames(names []string) ([]string, error) {
+	normalized := make([]string, 0, len(names))
+	seen := map[string]bool{}
+	for _, name := range names {
+		n, err := NormalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[n] {
+			seen[n] = true
+			normalized = append(normalized, n)
+		}
+	}
+	return normalized, nil
+}
+
+// AddVideoTags tags a video, creating tags that don't exist yet, and returns
+// all of the video's tags. Nothing is added if the video would end up over
+// MaxTagsPerVideo.
+func (c Client) AddVideoTags(videoID uuid.UUID, names []string) ([]string, error) {
+	names, err := normalizeTagNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the video so concurrent adds can't both pass the limit check
+	lock := `SELECT id FROM videos WHERE id = ?`
+	if tx.dialect == dialectPostgres {
+		lock += ` FOR UPDATE`
+	}
+	var id uuid.UUID
+	err = tx.QueryRow(lock, videoID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		_, err := tx.Exec(`INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`
+		INSERT INTO video_tags (video_id, tag_id)
+		SELECT ?, id FROM tags WHERE name = ?
+		ON CONFLICT (video_id, tag_id) DO NOTHING
+		`, videoID, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := getVideoTags(tx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > MaxTagsPerVideo {
+		return nil, ErrTooManyTags
+	}
+	return tags, tx.Commit()
+}
+
+// RemoveVideoTag untags a video. Removing a tag the video doesn't have is not
+// an error.
+func (c Client) RemoveVideoTag(videoID uuid.UUID, name string) error {
+	name, err := NormalizeTagName(name)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`
+	DELETE FROM video_tags
+	WHERE video_id = ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)
+	`, videoID, name)
+	return err
+}
+
+// GetVideoTags returns a video's tags in alphabetical order.
+func (c Client) GetVideoTags(videoID uuid.UUID) ([]string, error) {
+	return getVideoTags(c.db, videoID)
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func getVideoTags(q querier, videoID uuid.UUID) ([]string, error) {
+	rows, err := q.Query(`
+	SELECT t.name
+	FROM video_tags vt
+	JOIN tags t ON t.id = vt.tag_id
+	WHERE vt.video_id = ?
+	ORDER BY t.name
+	`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
+
+// SuggestTags autocompletes a tag from the tags on the user's own videos and
+// on public videos, most used first. Tags only found on other users' private
+// or unlisted videos are never suggested.
+func (c Client) SuggestTags(userID uuid.UUID, prefix string, limit int) ([]TagSuggestion, error) {
+	prefix = strings.Join(strings.Fields(strings.ToLower(prefix)), " ")
+	// Escape LIKE wildcards; '_' is valid in tag names
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+
+	rows, err := c.db.Query(`
+	SELECT t.name, COUNT(*) AS uses
+	FROM tags t
+	JOIN video_tags vt ON vt.tag_id = t.id
+	JOIN videos v ON v.id = vt.video_id
+	WHERE t.name LIKE ? ESCAPE '\'
+		AND (v.user_id = ? OR v.visibility = 'public')
+	GROUP BY t.name
+	ORDER BY uses DESC, t.name
+	LIMIT ?
+	`, escaped+"%", userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []TagSuggestion{}
+	for rows.Next() {
+		var s TagSuggestion
+		if err := rows.Scan(&s.Name, &s.Videos); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
+
+// tagFilter restricts a video query to videos carrying every one of tags,
+// which must not be empty.
+func tagFilter(tags []string) (string, []any, error) {
+	tags, err := normalizeTagNames(tags)
+	if err != nil {
+		return "", nil, err
+	}
+	args := make([]any, 0, len(tags)+1)
+	for _, t := range tags {
+		args = append(args, t)
+	}
+	args = append(args, len(tags))
+	cond := `v.id IN (
+		SELECT vt.video_id
+		FROM video_tags vt
+		JOIN tags t ON t.id = vt.tag_id
+		WHERE t.name IN (?` + strings.Repeat(", ?", len(tags)-1) + `)
+		GROUP BY vt.video_id
+		HAVING COUNT(*) = ?
+	)`
+	return cond, args, nil
+}
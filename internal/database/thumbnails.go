@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ThumbnailRendition is one resized copy of a video's thumbnail. A video's
+// renditions are stored together as a JSON array.
+type ThumbnailRendition struct {
+	MediaType string `json:"media_type"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	URL       string `json:"url"`
+	Key       string `json:"key"`
+}
+
+// ThumbnailSet groups the renditions of one media type, smallest first, with
+// a srcset ready for an <img> or <source> element.
+type ThumbnailSet struct {
+	Srcset string          `json:"srcset"`
+	Sizes  []ThumbnailSize `json:"sizes"`
+}
+
+type ThumbnailSize struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// ThumbnailSets groups renditions by media type for the video's JSON.
+func ThumbnailSets(renditions []ThumbnailRendition) map[string]ThumbnailSet {
+	sets := map[string]ThumbnailSet{}
+	for _, r := range renditions {
+		set := sets[r.MediaType]
+		set.Sizes = append(set.Sizes, ThumbnailSize{Width: r.Width, Height: r.Height, URL: r.URL})
+		sets[r.MediaType] = set
+	}
+	for mediaType, set := range sets {
+		entries := make([]string, len(set.Sizes))
+		for i, s := range set.Sizes {
+			entries[i] = fmt.Sprintf("%s %dw", s.URL, s.Width)
+		}
+		set.Srcset = strings.Join(entries, ", ")
+		sets[mediaType] = set
+	}
+	return sets
+}
+
+func scanThumbnailRenditions(s sql.NullString) ([]ThumbnailRendition, error) {
+	if !s.Valid || s.String == "" {
+		return nil, nil
+	}
+	var renditions []ThumbnailRendition
+	err := json.Unmarshal([]byte(s.String), &renditions)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode thumbnail renditions: %w", err)
+	}
+	return renditions, nil
+}
+
+func thumbnailRenditionsArg(renditions []ThumbnailRendition) (*string, error) {
+	if len(renditions) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(renditions)
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+	return &s, nil
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"database/sql"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tombstones record stored objects that no row references any more. They are
+// written in the same transaction that drops the reference, so an object is
+// never forgotten even if deleting it fails or the process dies first.
+const (
+	TombstoneStoreVideo     = "video"
+	TombstoneStoreThumbnail = "thumbnail"
+)
+
+type Tombstone struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Attempts  int       `json:"attempts"`
+	LastError *string   `json:"error"`
+	RunAt     time.Time `json:"run_at"`
+	CreateTombstoneParams
+}
+
+type CreateTombstoneParams struct {
+	Store string `json:"store"`
+	Key   string `json:"key"`
+	// Prefix marks Key as a prefix, so every object below it is deleted.
+	Prefix bool `json:"prefix"`
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func createTombstones(tx execer, params []CreateTombstoneParams) error {
+	query := `
+	INSERT INTO storage_tombstones (store, key, prefix, run_at)
+	VALUES (?, ?, ?, ?)
+	`
+	now := time.Now().UTC()
+	for _, p := range params {
+		_, err := tx.Exec(query, p.Store, p.Key, p.Prefix, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// videoAssetTombstones lists the objects referenced by a video's stored keys
+// that aren't referenced by next. Pass a nil next when the video is deleted.
+func videoAssetTombstones(prev videoKeys, next *videoKeys) []CreateTombstoneParams {
+	if next == nil {
+		next = &videoKeys{}
+	}
+	var params []CreateTombstoneParams
+	if prev.video != nil && !sameKey(prev.video, next.video) {
+		params = append(params, CreateTombstoneParams{Store: TombstoneStoreVideo, Key: *prev.video})
+	}
+	if prev.hls != nil && !sameKey(prev.hls, next.hls) {
+		// The master playlist sits at the root of its rendition tree
+		params = append(params, CreateTombstoneParams{
+			Store:  TombstoneStoreVideo,
+			Key:    path.Dir(*prev.hls) + "/",
+			Prefix: true,
+		})
+	}
+	if prev.thumbnail != nil && !sameKey(prev.thumbnail, next.thumbnail) {
+		params = append(params, thumbnailTombstone(*prev.thumbnail))
+	}
+	return params
+}
+
+// thumbnailTombstone covers a thumbnail and its renditions. Thumbnails with
+// renditions share a directory of their own; older ones are a single object.
+func thumbnailTombstone(key string) CreateTombstoneParams {
+	if dir := path.Dir(key); dir != "." {
+		return CreateTombstoneParams{Store: TombstoneStoreThumbnail, Key: dir + "/", Prefix: true}
+	}
+	return CreateTombstoneParams{Store: TombstoneStoreThumbnail, Key: key}
+}
+
+type videoKeys struct {
+	video, hls, thumbnail *string
+}
+
+func getVideoKeys(tx *txn, id uuid.UUID) (videoKeys, error) {
+	var keys videoKeys
+	err := tx.QueryRow(
+		`SELECT video_key, hls_key, thumbnail_key FROM videos WHERE id = ?`, id,
+	).Scan(&keys.video, &keys.hls, &keys.thumbnail)
+	return keys, err
+}
+
+func sameKey(a, b *string) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+const tombstoneColumns = `
+	id,
+	created_at,
+	store,
+	key,
+	prefix,
+	attempts,
+	last_error,
+	run_at
+`
+
+// GetDueTombstones returns up to limit tombstones whose deletion is due.
+func (c Client) GetDueTombstones(limit int) ([]Tombstone, error) {
+	query := `
+	SELECT` + tombstoneColumns + `
+	FROM storage_tombstones
+	WHERE run_at <= ?
+	ORDER BY run_at
+	LIMIT ?
+	`
+	rows, err := c.db.Query(query, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tombstones := []Tombstone{}
+	for rows.Next() {
+		var t Tombstone
+		err := rows.Scan(
+			&t.ID,
+			&t.CreatedAt,
+			&t.Store,
+			&t.Key,
+			&t.Prefix,
+			&t.Attempts,
+			&t.LastError,
+			&t.RunAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, t)
+	}
+	return tombstones, rows.Err()
+}
+
+// DeleteTombstone forgets a tombstone once its objects are gone.
+func (c Client) DeleteTombstone(id int64) error {
+	_, err := c.db.Exec(`DELETE FROM storage_tombstones WHERE id = ?`, id)
+	return err
+}
+
+// RetryTombstone records a failed deletion and schedules another attempt.
+func (c Client) RetryTombstone(id int64, errMsg string, runAt time.Time) error {
+	query := `
+	UPDATE storage_tombstones
+	SET
+		attempts = attempts + 1,
+		last_error = ?,
+		run_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, errMsg, runAt.UTC(), id)
+	return err
+}
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Upload tracks a resumable upload that is still receiving chunks.
+type Upload struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Offset      int64      `json:"offset"`
+	CompletedAt *time.Time `json:"completed_at"`
+	JobID       *uuid.UUID `json:"job_id"`
+	CreateUploadParams
+}
+
+type CreateUploadParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	VideoID   uuid.UUID `json:"video_id"`
+	Length    int64     `json:"length"`
+	MediaType string    `json:"media_type"`
+	Metadata  string    `json:"metadata"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+const uploadColumns = `
+	id,
+	created_at,
+	updated_at,
+	user_id,
+	video_id,
+	upload_length,
+	upload_offset,
+	media_type,
+	metadata,
+	expires_at,
+	completed_at,
+	job_id
+`
+
+func scanUpload(row interface{ Scan(...any) error }) (Upload, error) {
+	var upload Upload
+	err := row.Scan(
+		&upload.ID,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+		&upload.UserID,
+		&upload.VideoID,
+		&upload.Length,
+		&upload.Offset,
+		&upload.MediaType,
+		&upload.Metadata,
+		&upload.ExpiresAt,
+		&upload.CompletedAt,
+		&upload.JobID,
+	)
+	return upload, err
+}
+
+func (c Client) CreateUpload(params CreateUploadParams) (Upload, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO uploads (
+		id,
+		created_at,
+		updated_at,
+		user_id,
+		video_id,
+		upload_length,
+		upload_offset,
+		media_type,
+		metadata,
+		expires_at
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, 0, ?, ?, ?)
+	`
+	_, err := c.db.Exec(
+		query,
+		id,
+		params.UserID,
+		params.VideoID,
+		params.Length,
+		params.MediaType,
+		params.Metadata,
+		params.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	return c.GetUpload(id)
+}
+
+func (c Client) GetUpload(id uuid.UUID) (Upload, error) {
+	query := `SELECT ` + uploadColumns + ` FROM uploads WHERE id = ?`
+	upload, err := scanUpload(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Upload{}, nil
+		}
+		return Upload{}, err
+	}
+	return upload, nil
+}
+
+// AdvanceUploadOffset moves the offset from one value to another, reporting
+// false if the offset no longer matches from, i.e. a concurrent PATCH won.
+func (c Client) AdvanceUploadOffset(id uuid.UUID, from, to int64) (bool, error) {
+	query := `
+	UPDATE uploads
+	SET
+		upload_offset = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND upload_offset = ? AND completed_at IS NULL
+	`
+	res, err := c.db.Exec(query, to, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (c Client) CompleteUpload(id, jobID uuid.UUID) error {
+	query := `
+	UPDATE uploads
+	SET
+		completed_at = ?,
+		job_id = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, time.Now().UTC(), jobID, id)
+	return err
+}
+
+func (c Client) DeleteUpload(id uuid.UUID) error {
+	_, err := c.db.Exec(`DELETE FROM uploads WHERE id = ?`, id)
+	return err
+}
+
+// GetExpiredUploads returns uploads that expired before now, finished or not.
+func (c Client) GetExpiredUploads(now time.Time) ([]Upload, error) {
+	query := `SELECT ` + uploadColumns + ` FROM uploads WHERE expires_at < ?`
+	rows, err := c.db.Query(query, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []Upload{}
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
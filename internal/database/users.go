@@ -12,20 +12,47 @@ type User struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Role is one of the roles defined by auth.Role.
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at"`
 	CreateUserParams
 }
 
 type CreateUserParams struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email string `json:"email"`
+	// Password is the bcrypt hash, which never leaves the server.
+	Password string `json:"-"`
+}
+
+const userColumns = `
+		u.id,
+		u.created_at,
+		u.updated_at,
+		u.email,
+		u.password,
+		u.role,
+		u.disabled_at
+`
+
+func scanUser(row interface{ Scan(...any) error }) (User, error) {
+	var user User
+	var id string
+	err := row.Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password, &user.Role, &user.DisabledAt)
+	if err != nil {
+		return User{}, err
+	}
+	user.ID, err = uuid.Parse(id)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
 }
 
 func (c Client) GetUsers() ([]User, error) {
 	query := `
-		SELECT
-			id,
-			email
-		FROM users
+		SELECT` + userColumns + `
+		FROM users u
+		ORDER BY u.created_at, u.email
 	`
 
 	rows, err := c.db.Query(query)
@@ -36,64 +63,49 @@ func (c Client) GetUsers() ([]User, error) {
 
 	users := []User{}
 	for rows.Next() {
-		var user User
-		var id string
-		if err := rows.Scan(&id, &user.Email); err != nil {
-			return nil, err
-		}
-		user.ID, err = uuid.Parse(id)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
 func (c Client) GetUserByEmail(email string) (User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password
-		FROM users
-		WHERE email = ?
+		SELECT` + userColumns + `
+		FROM users u
+		WHERE u.email = ?
 	`
-	var user User
-	var id string
-	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	user, err := scanUser(c.db.QueryRow(query, email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return User{}, nil
 		}
 		return User{}, err
 	}
-	user.ID, err = uuid.Parse(id)
-	if err != nil {
-		return User{}, err
-	}
 	return user, nil
 }
 
+// GetUserByRefreshToken returns the owner of token if it is neither revoked
+// nor expired.
 func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 	query := `
-		SELECT u.id, u.email, u.created_at, u.updated_at, u.password
+		SELECT` + userColumns + `
 		FROM users u
 		JOIN refresh_tokens rt ON u.id = rt.user_id
-		WHERE rt.token = ?
+		WHERE rt.token = ? AND rt.revoked_at IS NULL AND rt.expires_at > ?
 	`
 
-	var user User
-	var id string
-	err := c.db.QueryRow(query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
+	user, err := scanUser(c.db.QueryRow(query, token, time.Now().UTC()))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	user.ID, err = uuid.Parse(id)
-	if err != nil {
-		return nil, err
-	}
 
 	return &user, nil
 }
@@ -117,24 +129,78 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 
 func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	query := `
-		SELECT id, created_at, updated_at, email, password
-		FROM users
-		WHERE id = ?
+		SELECT` + userColumns + `
+		FROM users u
+		WHERE u.id = ?
 	`
-	var user User
-	var idStr string
-	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	user, err := scanUser(c.db.QueryRow(query, id.String()))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	user.ID, err = uuid.Parse(idStr)
+	return &user, nil
+}
+
+// SetUserRole changes a user's role, reporting whether the user exists.
+func (c Client) SetUserRole(id uuid.UUID, role string) (bool, error) {
+	query := `
+		UPDATE users
+		SET role = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	res, err := c.db.Exec(query, role, id.String())
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	return &user, nil
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// SetUserDisabled disables or re-enables a user, reporting whether the user
+// exists. Disabling also revokes the user's refresh tokens so no new access
+// tokens can be issued.
+func (c Client) SetUserDisabled(id uuid.UUID, disabled bool) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET disabled_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+	if disabled {
+		// Keep the original time if the user was already disabled
+		query = `
+		UPDATE users
+		SET disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+		`
+	}
+	res, err := tx.Exec(query, id.String())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	if disabled {
+		_, err = tx.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND revoked_at IS NULL
+		`, id.String())
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
 }
 
 func (c Client) DeleteUser(id uuid.UUID) error {
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUsers(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "user@example.com")
+		if user.Role != "user" {
+			t.Errorf("new user has role %q, want user", user.Role)
+		}
+
+		byEmail, err := c.GetUserByEmail("user@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if byEmail.ID != user.ID {
+			t.Errorf("GetUserByEmail returned %s, want %s", byEmail.ID, user.ID)
+		}
+
+		_, err = c.CreateUser(CreateUserParams{Email: "user@example.com", Password: "hash"})
+		if err == nil {
+			t.Error("created a second user with the same email")
+		}
+
+		found, err := c.SetUserRole(user.ID, "admin")
+		if err != nil || !found {
+			t.Fatalf("SetUserRole = %v, %v", found, err)
+		}
+		got, err := c.GetUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Role != "admin" {
+			t.Errorf("role = %q after SetUserRole, want admin", got.Role)
+		}
+
+		err = c.DeleteUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = c.GetUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != nil {
+			t.Error("GetUser found a deleted user")
+		}
+	})
+}
+
+func TestGetMissingUser(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user, err := c.GetUser(uuid.New())
+		if err != nil || user != nil {
+			t.Errorf("GetUser(unknown) = %v, %v; want nil, nil", user, err)
+		}
+		byEmail, err := c.GetUserByEmail("nobody@example.com")
+		if err != nil || byEmail.ID != uuid.Nil {
+			t.Errorf("GetUserByEmail(unknown) = %v, %v; want zero user", byEmail, err)
+		}
+	})
+}
+
+func TestDisablingUserRevokesRefreshTokens(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "disabled@example.com")
+		createTestRefreshToken(t, c, user.ID, "token")
+
+		found, err := c.SetUserDisabled(user.ID, true)
+		if err != nil || !found {
+			t.Fatalf("SetUserDisabled = %v, %v", found, err)
+		}
+		got, err := c.GetUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.DisabledAt == nil {
+			t.Error("user isn't disabled")
+		}
+		rt, err := c.GetRefreshToken("token")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rt.RevokedAt == nil {
+			t.Error("a disabled user's refresh token wasn't revoked")
+		}
+	})
+}
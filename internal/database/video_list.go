@@ -0,0 +1,243 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoSort string
+
+const (
+	VideoSortCreatedAt VideoSort = "created_at"
+	VideoSortUpdatedAt VideoSort = "updated_at"
+	VideoSortTitle     VideoSort = "title"
+	VideoSortDuration  VideoSort = "duration"
+)
+
+// ErrInvalidCursor is returned for cursors that weren't issued by ListVideos
+// for the same sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sortExpr is the column each sort orders by. Unprocessed videos have no
+// duration and sort as shorter than any processed one.
+func (s VideoSort) sortExpr() (string, bool) {
+	switch s {
+	case VideoSortCreatedAt:
+		return "v.created_at", true
+	case VideoSortUpdatedAt:
+		return "v.updated_at", true
+	case VideoSortTitle:
+		return "v.title", true
+	case VideoSortDuration:
+		return "COALESCE(m.duration_seconds, -1)", true
+	}
+	return "", false
+}
+
+func (s VideoSort) Valid() bool {
+	_, ok := s.sortExpr()
+	return ok
+}
+
+type ListVideosParams struct {
+	UserID    uuid.UUID
+	Sort      VideoSort
+	Ascending bool
+	// Limit caps the page size; zero returns every matching video.
+	Limit int
+	// Cursor continues a previous listing. Filters aren't part of it, so
+	// callers must repeat them on every page.
+	Cursor string
+
+	HasVideo      *bool
+	HasThumbnail  *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Aspect        string
+	// Tags keeps videos that carry every one of them.
+	Tags []string
+}
+
+type VideoPage struct {
+	Videos []Video
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// videoCursor is the position after the last video of a page, encoded as
+// base64 JSON so clients treat it as opaque.
+type videoCursor struct {
+	Sort      VideoSort  `json:"s"`
+	Ascending bool       `json:"a"`
+	Time      *time.Time `json:"t,omitempty"`
+	Text      *string    `json:"x,omitempty"`
+	Number    *float64   `json:"n,omitempty"`
+	ID        uuid.UUID  `json:"i"`
+}
+
+func newVideoCursor(sort VideoSort, ascending bool, last Video) videoCursor {
+	cur := videoCursor{Sort: sort, Ascending: ascending, ID: last.ID}
+	switch sort {
+	case VideoSortCreatedAt:
+		cur.Time = &last.CreatedAt
+	case VideoSortUpdatedAt:
+		cur.Time = &last.UpdatedAt
+	case VideoSortTitle:
+		cur.Text = &last.Title
+	case VideoSortDuration:
+		d := -1.0
+		if last.Media != nil {
+			d = last.Media.Duration
+		}
+		cur.Number = &d
+	}
+	return cur
+}
+
+func (cur videoCursor) encode() (string, error) {
+	data, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeVideoCursor(s string) (videoCursor, error) {
+	var cur videoCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, ErrInvalidCursor
+	}
+	if json.Unmarshal(data, &cur) != nil {
+		return cur, ErrInvalidCursor
+	}
+	return cur, nil
+}
+
+// cursorValue returns the cursor's sort value as a query argument.
+func (c Client) cursorValue(cur videoCursor) (any, bool) {
+	switch {
+	case cur.Time != nil && (cur.Sort == VideoSortCreatedAt || cur.Sort == VideoSortUpdatedAt):
+		return c.timeArg(*cur.Time), true
+	case cur.Text != nil && cur.Sort == VideoSortTitle:
+		return *cur.Text, true
+	case cur.Number != nil && cur.Sort == VideoSortDuration:
+		return *cur.Number, true
+	}
+	return nil, false
+}
+
+// ListVideos returns one page of a user's videos using keyset pagination, so
+// deep pages cost the same as the first. Without a limit it returns them all.
+func (c Client) ListVideos(params ListVideosParams) (VideoPage, error) {
+	if params.Sort == "" {
+		params.Sort = VideoSortCreatedAt
+	}
+	sortExpr, ok := params.Sort.sortExpr()
+	if !ok {
+		return VideoPage{}, fmt.Errorf("unknown sort %q", params.Sort)
+	}
+	if params.Limit < 0 {
+		return VideoPage{}, errors.New("limit must not be negative")
+	}
+
+	where := []string{"v.user_id = ?"}
+	args := []any{params.UserID}
+
+	if params.HasVideo != nil {
+		if *params.HasVideo {
+			where = append(where, "(v.video_key IS NOT NULL OR v.video_url IS NOT NULL)")
+		} else {
+			where = append(where, "v.video_key IS NULL AND v.video_url IS NULL")
+		}
+	}
+	if params.HasThumbnail != nil {
+		if *params.HasThumbnail {
+			where = append(where, "v.thumbnail_url IS NOT NULL")
+		} else {
+			where = append(where, "v.thumbnail_url IS NULL")
+		}
+	}
+	if params.CreatedAfter != nil {
+		where = append(where, "v.created_at >= ?")
+		args = append(args, c.timeArg(*params.CreatedAfter))
+	}
+	if params.CreatedBefore != nil {
+		where = append(where, "v.created_at < ?")
+		args = append(args, c.timeArg(*params.CreatedBefore))
+	}
+	if params.Aspect != "" {
+		where = append(where, "m.aspect = ?")
+		args = append(args, params.Aspect)
+	}
+	if len(params.Tags) > 0 {
+		cond, tagArgs, err := tagFilter(params.Tags)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		where = append(where, cond)
+		args = append(args, tagArgs...)
+	}
+
+	cmp, dir := "<", "DESC"
+	if params.Ascending {
+		cmp, dir = ">", "ASC"
+	}
+	if params.Cursor != "" {
+		cur, err := decodeVideoCursor(params.Cursor)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		value, ok := c.cursorValue(cur)
+		if !ok || cur.Sort != params.Sort || cur.Ascending != params.Ascending {
+			return VideoPage{}, ErrInvalidCursor
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND v.id %[2]s ?))", sortExpr, cmp))
+		args = append(args, value, value, cur.ID)
+	}
+
+	query := `
+	SELECT` + videoColumns + videoFrom + `
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY ` + sortExpr + ` ` + dir + `, v.id ` + dir
+	if params.Limit > 0 {
+		// One extra row tells us whether there is another page
+		query += `
+	LIMIT ?`
+		args = append(args, params.Limit+1)
+	}
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	page := VideoPage{Videos: []Video{}}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		page.Videos = append(page.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoPage{}, err
+	}
+
+	if params.Limit > 0 && len(page.Videos) > params.Limit {
+		page.Videos = page.Videos[:params.Limit]
+		last := page.Videos[len(page.Videos)-1]
+		page.NextCursor, err = newVideoCursor(params.Sort, params.Ascending, last).encode()
+		if err != nil {
+			return VideoPage{}, err
+		}
+	}
+	return page, nil
+}
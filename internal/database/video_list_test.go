@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestListVideos(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "list@example.com")
+		for _, title := range []string{"Delta", "Alpha", "Charlie", "Bravo"} {
+			createTestVideo(t, c, user.ID, title, "", VisibilityPublic)
+		}
+
+		// Without a limit every video comes back and there is no next page
+		all, err := c.ListVideos(ListVideosParams{UserID: user.ID, Sort: VideoSortTitle, Ascending: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all.Videos) != 4 || all.NextCursor != "" {
+			t.Fatalf("unlimited listing returned %d videos and cursor %q", len(all.Videos), all.NextCursor)
+		}
+
+		var titles []string
+		params := ListVideosParams{UserID: user.ID, Sort: VideoSortTitle, Ascending: true, Limit: 3}
+		for {
+			page, err := c.ListVideos(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, video := range page.Videos {
+				titles = append(titles, video.Title)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			params.Cursor = page.NextCursor
+		}
+		want := []string{"Alpha", "Bravo", "Charlie", "Delta"}
+		if len(titles) != len(want) {
+			t.Fatalf("paged titles = %v, want %v", titles, want)
+		}
+		for i := range want {
+			if titles[i] != want[i] {
+				t.Fatalf("paged titles = %v, want %v", titles, want)
+			}
+		}
+
+		// Cursors only continue the sort they were issued for
+		params.Sort = VideoSortCreatedAt
+		if _, err := c.ListVideos(params); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor reused with another sort: err = %v", err)
+		}
+	})
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// VideoMedia is the technical metadata extracted from an uploaded video file.
+type VideoMedia struct {
+	Container  string  `json:"container"`
+	Duration   float64 `json:"duration_seconds"`
+	BitRate    int64   `json:"bit_rate"`
+	SizeBytes  int64   `json:"size_bytes"`
+	VideoCodec string  `json:"video_codec"`
+	AudioCodec *string `json:"audio_codec"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	FrameRate  float64 `json:"frame_rate"`
+	Rotation   int     `json:"rotation"`
+	// Aspect is the display orientation: landscape, portrait or other.
+	Aspect string `json:"aspect"`
+	// Transcode is set when the upload wasn't web-playable as it was and had
+	// to be transcoded; the rest describes the transcoded file.
+	Transcode *VideoTranscode `json:"transcode"`
+}
+
+// TranscodeProfile holds the ffmpeg settings uploads are transcoded with.
+// MaxResolution caps the short side, as with HLS rungs.
+type TranscodeProfile struct {
+	CRF           int    `json:"crf"`
+	Preset        string `json:"preset"`
+	MaxResolution int    `json:"max_resolution"`
+	AudioBitrate  string `json:"audio_bitrate"`
+}
+
+// VideoTranscode records how and from what a video was transcoded.
+type VideoTranscode struct {
+	TranscodeProfile
+	SourceType       string  `json:"source_type"`
+	SourceVideoCodec string  `json:"source_video_codec"`
+	SourceAudioCodec *string `json:"source_audio_codec"`
+}
+
+const videoMediaColumns = `
+		m.video_id,
+		m.container,
+		m.duration_seconds,
+		m.bit_rate,
+		m.size_bytes,
+		m.video_codec,
+		m.audio_codec,
+		m.width,
+		m.height,
+		m.frame_rate,
+		m.rotation,
+		m.aspect,
+		m.transcode_crf,
+		m.transcode_preset,
+		m.transcode_max_resolution,
+		m.transcode_audio_bitrate,
+		m.source_type,
+		m.source_video_codec,
+		m.source_audio_codec
+`
+
+// nullVideoMedia scans the LEFT JOINed video_media columns, which are all NULL
+// for videos that haven't been processed yet.
+type nullVideoMedia struct {
+	VideoID    sql.NullString
+	Container  sql.NullString
+	Duration   sql.NullFloat64
+	BitRate    sql.NullInt64
+	SizeBytes  sql.NullInt64
+	VideoCodec sql.NullString
+	AudioCodec sql.NullString
+	Width      sql.NullInt64
+	Height     sql.NullInt64
+	FrameRate  sql.NullFloat64
+	Rotation   sql.NullInt64
+	Aspect     sql.NullString
+
+	TranscodeCRF           sql.NullInt64
+	TranscodePreset        sql.NullString
+	TranscodeMaxResolution sql.NullInt64
+	TranscodeAudioBitrate  sql.NullString
+	SourceType             sql.NullString
+	SourceVideoCodec       sql.NullString
+	SourceAudioCodec       sql.NullString
+}
+
+func (n *nullVideoMedia) dest() []any {
+	return []any{
+		&n.VideoID,
+		&n.Container,
+		&n.Duration,
+		&n.BitRate,
+		&n.SizeBytes,
+		&n.VideoCodec,
+		&n.AudioCodec,
+		&n.Width,
+		&n.Height,
+		&n.FrameRate,
+		&n.Rotation,
+		&n.Aspect,
+		&n.TranscodeCRF,
+		&n.TranscodePreset,
+		&n.TranscodeMaxResolution,
+		&n.TranscodeAudioBitrate,
+		&n.SourceType,
+		&n.SourceVideoCodec,
+		&n.SourceAudioCodec,
+	}
+}
+
+func (n *nullVideoMedia) media() *VideoMedia {
+	if !n.VideoID.Valid {
+		return nil
+	}
+	m := &VideoMedia{
+		Container:  n.Container.String,
+		Duration:   n.Duration.Float64,
+		BitRate:    n.BitRate.Int64,
+		SizeBytes:  n.SizeBytes.Int64,
+		VideoCodec: n.VideoCodec.String,
+		Width:      int(n.Width.Int64),
+		Height:     int(n.Height.Int64),
+		FrameRate:  n.FrameRate.Float64,
+		Rotation:   int(n.Rotation.Int64),
+		Aspect:     n.Aspect.String,
+	}
+	if n.AudioCodec.Valid {
+		m.AudioCodec = &n.AudioCodec.String
+	}
+	if n.TranscodePreset.Valid {
+		m.Transcode = &VideoTranscode{
+			TranscodeProfile: TranscodeProfile{
+				CRF:           int(n.TranscodeCRF.Int64),
+				Preset:        n.TranscodePreset.String,
+				MaxResolution: int(n.TranscodeMaxResolution.Int64),
+				AudioBitrate:  n.TranscodeAudioBitrate.String,
+			},
+			SourceType:       n.SourceType.String,
+			SourceVideoCodec: n.SourceVideoCodec.String,
+		}
+		if n.SourceAudioCodec.Valid {
+			m.Transcode.SourceAudioCodec = &n.SourceAudioCodec.String
+		}
+	}
+	return m
+}
+
+func (c Client) UpsertVideoMedia(videoID uuid.UUID, media VideoMedia) error {
+	query := `
+	INSERT INTO video_media (
+		video_id,
+		created_at,
+		updated_at,
+		container,
+		duration_seconds,
+		bit_rate,
+		size_bytes,
+		video_codec,
+		audio_codec,
+		width,
+		height,
+		frame_rate,
+		rotation,
+		aspect,
+		transcode_crf,
+		transcode_preset,
+		transcode_max_resolution,
+		transcode_audio_bitrate,
+		source_type,
+		source_video_codec,
+		source_audio_codec
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (video_id) DO UPDATE SET
+		updated_at = CURRENT_TIMESTAMP,
+		container = excluded.container,
+		duration_seconds = excluded.duration_seconds,
+		bit_rate = excluded.bit_rate,
+		size_bytes = excluded.size_bytes,
+		video_codec = excluded.video_codec,
+		audio_codec = excluded.audio_codec,
+		width = excluded.width,
+		height = excluded.height,
+		frame_rate = excluded.frame_rate,
+		rotation = excluded.rotation,
+		aspect = excluded.aspect,
+		transcode_crf = excluded.transcode_crf,
+		transcode_preset = excluded.transcode_preset,
+		transcode_max_resolution = excluded.transcode_max_resolution,
+		transcode_audio_bitrate = excluded.transcode_audio_bitrate,
+		source_type = excluded.source_type,
+		source_video_codec = excluded.source_video_codec,
+		source_audio_codec = excluded.source_audio_codec
+	`
+	var crf, maxResolution *int
+	var preset, audioBitrate, sourceType, sourceVideoCodec, sourceAudioCodec *string
+	if t := media.Transcode; t != nil {
+		crf, preset, maxResolution, audioBitrate = &t.CRF, &t.Preset, &t.MaxResolution, &t.AudioBitrate
+		sourceType, sourceVideoCodec, sourceAudioCodec = &t.SourceType, &t.SourceVideoCodec, t.SourceAudioCodec
+	}
+	_, err := c.db.Exec(
+		query,
+		videoID,
+		media.Container,
+		media.Duration,
+		media.BitRate,
+		media.SizeBytes,
+		media.VideoCodec,
+		media.AudioCodec,
+		media.Width,
+		media.Height,
+		media.FrameRate,
+		media.Rotation,
+		media.Aspect,
+		crf,
+		preset,
+		maxResolution,
+		audioBitrate,
+		sourceType,
+		sourceVideoCodec,
+		sourceAudioCodec,
+	)
+	return err
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// ErrEmptySearch is returned for queries without a single searchable word.
+var ErrEmptySearch = errors.New("search query has no words")
+
+type SearchVideosParams struct {
+	// UserID's videos are searched along with every public video.
+	UserID uuid.UUID
+	// Query is a list of words that must all match. A trailing * makes a
+	// word a prefix and double quotes match a phrase.
+	Query  string
+	Limit  int
+	Offset int
+}
+
+type VideoSearchResult struct {
+	Video
+	// Rank orders results; higher is a better match.
+	Rank float64 `json:"rank"`
+	// The snippets are HTML with matches wrapped in <mark>.
+	TitleSnippet       string `json:"title_snippet"`
+	DescriptionSnippet string `json:"description_snippet"`
+}
+
+// Snippets are marked up by the database with control characters, so the
+// text around them can be escaped before the marks become HTML.
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+func highlightSnippet(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, snippetStart, "<mark>")
+	return strings.ReplaceAll(s, snippetEnd, "</mark>")
+}
+
+type searchTerm struct {
+	words  []string
+	prefix bool
+}
+
+// parseSearchQuery splits a query into terms. Punctuation separates words,
+// so "slow-mo" becomes the phrase "slow mo", the way both full-text engines
+// tokenize it.
+func parseSearchQuery(q string) []searchTerm {
+	var terms []searchTerm
+	add := func(text string, phrase bool) {
+		prefix := false
+		if !phrase {
+			text, prefix = strings.CutSuffix(text, "*")
+		}
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if len(words) > 0 {
+			terms = append(terms, searchTerm{words: words, prefix: prefix})
+		}
+	}
+
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		if rest, ok := strings.CutPrefix(q, `"`); ok {
+			// An unterminated phrase runs to the end of the query
+			phrase, after, _ := strings.Cut(rest, `"`)
+			add(phrase, true)
+			q = after
+			continue
+		}
+		end := strings.IndexFunc(q, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		if end < 0 {
+			end = len(q)
+		}
+		add(q[:end], false)
+		q = q[end:]
+	}
+	return terms
+}
+
+// ftsQuery renders terms in SQLite FTS query syntax. Words are only letters
+// and digits, so quoting them is enough to keep them from being operators.
+func ftsQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		phrase := strings.Join(t.words, " ")
+		if t.prefix {
+			phrase += "*"
+		}
+		parts[i] = `"` + phrase + `"`
+	}
+	return strings.Join(parts, " ")
+}
+
+// tsQuery renders terms for PostgreSQL's to_tsquery.
+func tsQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		lexemes := make([]string, len(t.words))
+		for j, w := range t.words {
+			lexemes[j] = "'" + w + "'"
+		}
+		if t.prefix {
+			lexemes[len(lexemes)-1] += ":*"
+		}
+		parts[i] = "(" + strings.Join(lexemes, " <-> ") + ")"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// SearchVideos finds videos matching a full-text query, best matches first.
+// Titles weigh more than descriptions.
+func (c Client) SearchVideos(params SearchVideosParams) ([]VideoSearchResult, error) {
+	if params.Limit <= 0 {
+		return nil, errors.New("limit must be positive")
+	}
+	terms := parseSearchQuery(params.Query)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+
+	var query string
+	var args []any
+	switch c.db.dialect {
+	case dialectPostgres:
+		query = `
+		SELECT` + videoColumns + `,
+			ts_rank(v.search, q.query) AS score,
+			ts_headline('english', v.title, q.query, ?),
+			ts_headline('english', COALESCE(v.description, ''), q.query, ?)
+		FROM videos v
+		CROSS JOIN to_tsquery('english', ?) AS q(query)
+		LEFT JOIN video_media m ON m.video_id = v.id
+		WHERE v.search @@ q.query
+			AND (v.user_id = ? OR v.visibility = 'public')
+		ORDER BY score DESC, v.id
+		LIMIT ? OFFSET ?
+		`
+		marks := `StartSel="` + snippetStart + `", StopSel="` + snippetEnd + `"`
+		args = []any{
+			"HighlightAll=true, " + marks,
+			"MaxFragments=1, MaxWords=20, MinWords=5, " + marks,
+			tsQuery(terms), params.UserID, params.Limit, params.Offset,
+		}
+	default:
+		// A title match counts ten times a description match
+		query = `
+		SELECT` + videoColumns + `,
+			fts_rank(matchinfo(videos_fts, 'pcx'), 10.0, 1.0) AS score,
+			snippet(videos_fts, '` + snippetStart + `', '` + snippetEnd + `', '…', 0, 64),
+			snippet(videos_fts, '` + snippetStart + `', '` + snippetEnd + `', '…', 1, 20)
+		FROM videos_fts
+		JOIN video_search_docids d ON d.docid = videos_fts.docid
+		JOIN videos v ON v.id = d.video_id
+		LEFT JOIN video_media m ON m.video_id = v.id
+		WHERE videos_fts MATCH ?
+			AND (v.user_id = ? OR v.visibility = 'public')
+		ORDER BY score DESC, v.id
+		LIMIT ? OFFSET ?
+		`
+		args = []any{ftsQuery(terms), params.UserID, params.Limit, params.Offset}
+	}
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var r VideoSearchResult
+		r.Video, err = scanVideo(withExtraColumns{rows, []any{&r.Rank, &r.TitleSnippet, &r.DescriptionSnippet}})
+		if err != nil {
+			return nil, err
+		}
+		r.TitleSnippet = highlightSnippet(r.TitleSnippet)
+		r.DescriptionSnippet = highlightSnippet(r.DescriptionSnippet)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// ftsRank backs the fts_rank SQL function, which scores a row from its
+// matchinfo(videos_fts, 'pcx') blob: for every phrase and column, the row's
+// share of all hits, times that column's weight. FTS4 has no ranking
+// function of its own.
+func ftsRank(matchinfo []byte, weights ...float64) float64 {
+	info := make([]uint32, len(matchinfo)/4)
+	for i := range info {
+		info[i] = binary.NativeEndian.Uint32(matchinfo[i*4:])
+	}
+	if len(info) < 2 {
+		return 0
+	}
+	phrases, columns := int(info[0]), int(info[1])
+	if len(info) < 2+3*phrases*columns {
+		return 0
+	}
+
+	var rank float64
+	for p := range phrases {
+		for col := range min(columns, len(weights)) {
+			hits := info[2+3*(p*columns+col):]
+			if hits[0] > 0 {
+				rank += weights[col] * float64(hits[0]) / float64(hits[1])
+			}
+		}
+	}
+	return rank
+}
+
+// withExtraColumns scans columns selected after videoColumns.
+type withExtraColumns struct {
+	row   interface{ Scan(...any) error }
+	extra []any
+}
+
+func (w withExtraColumns) Scan(dest ...any) error {
+	return w.row.Scan(append(dest, w.extra...)...)
+}
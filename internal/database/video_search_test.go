@@ -0,0 +1,95 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSearchVideos(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		owner := createTestUser(t, c, "search@example.com")
+		other := createTestUser(t, c, "other@example.com")
+		inTitle := createTestVideo(t, c, owner.ID, "Running cats", "", VisibilityPublic)
+		inDescription := createTestVideo(t, c, owner.ID, "Dog park", "cats chasing dogs", VisibilityPublic)
+		private := createTestVideo(t, c, owner.ID, "Secret cats", "", VisibilityPrivate)
+
+		results, err := c.SearchVideos(SearchVideosParams{UserID: other.ID, Query: "cat", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[0].ID != inTitle.ID || results[1].ID != inDescription.ID {
+			t.Fatalf("search for cat found %+v, want the title match before the description match", results)
+		}
+		if results[0].Rank <= results[1].Rank {
+			t.Errorf("title match ranked %v, description match %v", results[0].Rank, results[1].Rank)
+		}
+		if results[0].TitleSnippet != "Running <mark>cats</mark>" {
+			t.Errorf("title snippet = %q", results[0].TitleSnippet)
+		}
+
+		// Owners also find their private videos
+		results, err = c.SearchVideos(SearchVideosParams{UserID: owner.ID, Query: "secret", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].ID != private.ID {
+			t.Errorf("owner's search for secret found %+v", results)
+		}
+
+		// Renames and deletes reach the index
+		inTitle.Title = "Running dogs"
+		err = c.UpdateVideo(inTitle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.DeleteVideo(inDescription.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err = c.SearchVideos(SearchVideosParams{UserID: other.ID, Query: "cat", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 0 {
+			t.Errorf("search for cat found %+v after the rename and delete", results)
+		}
+
+		results, err = c.SearchVideos(SearchVideosParams{UserID: other.ID, Query: "runn*", Limit: 1, Offset: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 0 {
+			t.Errorf("second page of one result = %+v", results)
+		}
+
+		_, err = c.SearchVideos(SearchVideosParams{Query: "!!", Limit: 10})
+		if !errors.Is(err, ErrEmptySearch) {
+			t.Errorf("searching for punctuation gave %v, want ErrEmptySearch", err)
+		}
+	})
+}
+
+func TestSearchIndexSurvivesMigrations(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "reindex@example.com")
+		createTestVideo(t, c, user.ID, "Survives", "", VisibilityPublic)
+
+		// Back to before search existed, then up again
+		err := c.MigrateTo(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.MigrateUp()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := c.SearchVideos(SearchVideosParams{Query: "survives", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("got %d search results after reindexing, want 1", len(results))
+		}
+	})
+}
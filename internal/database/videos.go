@@ -13,30 +13,115 @@ type Video struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	// ThumbnailGenerated is set when the thumbnail was extracted from the
+	// video rather than uploaded, so it may be replaced automatically.
+	ThumbnailGenerated bool    `json:"thumbnail_generated"`
+	VideoURL           *string `json:"video_url"`
+	HLSURL             *string `json:"hls_url"`
+	// VideoKey and HLSKey locate the stored objects. Private videos only
+	// store keys and get short-lived URLs when they're read.
+	VideoKey     *string `json:"-"`
+	HLSKey       *string `json:"-"`
+	ThumbnailKey *string `json:"-"`
+	// ThumbnailRenditions are the stored sizes of the thumbnail; Thumbnails
+	// presents them grouped by media type.
+	ThumbnailRenditions []ThumbnailRendition    `json:"-"`
+	Thumbnails          map[string]ThumbnailSet `json:"thumbnails"`
+	Media               *VideoMedia             `json:"media"`
+	// Version goes up by one with every update.
+	Version int `json:"version"`
 	CreateVideoParams
 }
 
+type Visibility string
+
+const (
+	VisibilityPublic   Visibility = "public"
+	VisibilityUnlisted Visibility = "unlisted"
+	VisibilityPrivate  Visibility = "private"
+)
+
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Visibility  Visibility `json:"visibility"`
+	UserID      uuid.UUID  `json:"user_id"`
+}
+
+// videoColumns and videoFrom must be used together; every video query joins
+// in the extracted media metadata.
+const videoColumns = `
+		v.id,
+		v.created_at,
+		v.updated_at,
+		v.title,
+		v.description,
+		v.thumbnail_url,
+		v.thumbnail_generated,
+		v.video_url,
+		v.hls_url,
+		v.video_key,
+		v.hls_key,
+		v.thumbnail_key,
+		v.thumbnail_renditions,
+		v.version,
+		v.visibility,
+		v.user_id,
+` + videoMediaColumns
+
+const videoFrom = `
+	FROM videos v
+	LEFT JOIN video_media m ON m.video_id = v.id
+`
+
+func scanVideo(row interface{ Scan(...any) error }) (Video, error) {
+	var video Video
+	var media nullVideoMedia
+	var renditions sql.NullString
+	dest := []any{
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.ThumbnailGenerated,
+		&video.VideoURL,
+		&video.HLSURL,
+		&video.VideoKey,
+		&video.HLSKey,
+		&video.ThumbnailKey,
+		&renditions,
+		&video.Version,
+		&video.Visibility,
+		&video.UserID,
+	}
+	err := row.Scan(append(dest, media.dest()...)...)
+	if err != nil {
+		return Video{}, err
+	}
+	video.Media = media.media()
+	video.ThumbnailRenditions, err = scanThumbnailRenditions(renditions)
+	if err != nil {
+		return Video{}, err
+	}
+	video.Thumbnails = ThumbnailSets(video.ThumbnailRenditions)
+	return video, nil
 }
 
 func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
+	SELECT` + videoColumns + videoFrom + `
+	WHERE v.user_id = ?
+	ORDER BY v.created_at DESC
 	`
 
 	rows, err := c.db.Query(query, userID)
@@ -47,17 +132,8 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
@@ -75,10 +151,14 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
+		visibility,
 		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	if params.Visibility == "" {
+		params.Visibility = VisibilityPublic
+	}
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.Visibility, params.UserID)
 	if err != nil {
 		return Video{}, err
 	}
@@ -88,29 +168,11 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
-	FROM videos
-	WHERE id = ?
+	SELECT` + videoColumns + videoFrom + `
+	WHERE v.id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -121,35 +183,267 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	return video, nil
 }
 
+// ErrVideoConflict is returned by UpdateVideoIfVersion when the video was
+// changed or deleted since the caller read it.
+var ErrVideoConflict = errors.New("video was changed by another request")
+
+// UpdateVideo saves video. Stored objects it no longer references are
+// tombstoned in the same transaction.
 func (c Client) UpdateVideo(video Video) error {
+	return c.updateVideo(video, nil)
+}
+
+// UpdateVideoIfVersion saves video only if it is still at version.
+func (c Client) UpdateVideoIfVersion(video Video, version int) error {
+	return c.updateVideo(video, &version)
+}
+
+// modifyVideoAttempts bounds how many times ModifyVideo re-reads a video that
+// keeps changing underneath it.
+const modifyVideoAttempts = 5
+
+// ModifyVideo reads the video, lets change edit it and saves it, starting over
+// if another request saved the video in between. It returns the saved video,
+// or a zero Video if there's no video with that ID.
+func (c Client) ModifyVideo(id uuid.UUID, change func(*Video)) (Video, error) {
+	for range modifyVideoAttempts {
+		video, err := c.GetVideo(id)
+		if err != nil || video.ID == uuid.Nil {
+			return Video{}, err
+		}
+		change(&video)
+		err = c.UpdateVideoIfVersion(video, video.Version)
+		if errors.Is(err, ErrVideoConflict) {
+			continue
+		}
+		if err != nil {
+			return Video{}, err
+		}
+		return c.GetVideo(id)
+	}
+	return Video{}, ErrVideoConflict
+}
+
+func (c Client) updateVideo(video Video, version *int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	prev, err := getVideoKeys(tx, video.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if version != nil {
+			return ErrVideoConflict
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	renditions, err := thumbnailRenditionsArg(video.ThumbnailRenditions)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	UPDATE videos
 	SET
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
+		thumbnail_generated = ?,
 		video_url = ?,
-		user_id = ?
+		hls_url = ?,
+		video_key = ?,
+		hls_key = ?,
+		thumbnail_key = ?,
+		thumbnail_renditions = ?,
+		visibility = ?,
+		user_id = ?,
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1
 	WHERE id = ?
 	`
-
-	_, err := c.db.Exec(
-		query,
+	args := []any{
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
+		video.ThumbnailGenerated,
 		&video.VideoURL,
+		&video.HLSURL,
+		&video.VideoKey,
+		&video.HLSKey,
+		&video.ThumbnailKey,
+		renditions,
+		video.Visibility,
 		video.UserID,
 		video.ID,
-	)
-	return err
+	}
+	if version != nil {
+		query += ` AND version = ?`
+		args = append(args, *version)
+	}
+
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if version != nil {
+			return ErrVideoConflict
+		}
+		return nil
+	}
+
+	err = createTombstones(tx, videoAssetTombstones(prev, &videoKeys{
+		video:     video.VideoKey,
+		hls:       video.HLSKey,
+		thumbnail: video.ThumbnailKey,
+	}))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetGeneratedThumbnail stores a generated thumbnail unless the video has an
+// uploaded one, reporting whether the thumbnail was set. A previously
+// generated thumbnail is tombstoned.
+func (c Client) SetGeneratedThumbnail(id uuid.UUID, thumbnailURL, thumbnailKey string, renditions []ThumbnailRendition) (bool, error) {
+	return c.setThumbnail(id, thumbnailURL, thumbnailKey, renditions, true)
+}
+
+// SetUploadedThumbnail stores an uploaded thumbnail, replacing whatever the
+// video had, and reports whether the video still exists. Only the thumbnail
+// columns are written, so concurrent edits to the rest of the row survive.
+func (c Client) SetUploadedThumbnail(id uuid.UUID, thumbnailURL, thumbnailKey string, renditions []ThumbnailRendition) (bool, error) {
+	return c.setThumbnail(id, thumbnailURL, thumbnailKey, renditions, false)
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
+func (c Client) setThumbnail(id uuid.UUID, thumbnailURL, thumbnailKey string, renditions []ThumbnailRendition, generated bool) (bool, error) {
+	renditionsArg, err := thumbnailRenditionsArg(renditions)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	prev, err := getVideoKeys(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
 	query := `
-	DELETE FROM videos
+	UPDATE videos
+	SET
+		thumbnail_url = ?,
+		thumbnail_key = ?,
+		thumbnail_renditions = ?,
+		thumbnail_generated = ?,
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
-	return err
+	if generated {
+		// Never replace a thumbnail the owner uploaded
+		query += ` AND (thumbnail_url IS NULL OR thumbnail_generated)`
+	}
+	res, err := tx.Exec(query, thumbnailURL, thumbnailKey, renditionsArg, generated, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	err = createTombstones(tx, videoAssetTombstones(
+		videoKeys{thumbnail: prev.thumbnail},
+		&videoKeys{thumbnail: &thumbnailKey},
+	))
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// DeleteVideo deletes a video and tombstones its stored objects, along with
+// any extra objects the caller knows belong to it, in one transaction.
+func (c Client) DeleteVideo(id uuid.UUID, extra ...CreateTombstoneParams) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	prev, err := getVideoKeys(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM video_media WHERE video_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM video_tags WHERE video_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	err = removeVideoFromPlaylists(tx, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM videos WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	err = createTombstones(tx, append(videoAssetTombstones(prev, nil), extra...))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAllVideos returns every video regardless of owner.
+func (c Client) GetAllVideos() ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + videoFrom + `
+	ORDER BY v.created_at DESC
+	`
+
+	rows, err := c.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
 }
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestCreateAndGetVideo(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "videos@example.com")
+		video := createTestVideo(t, c, user.ID, "Title", "Description", VisibilityUnlisted)
+
+		got, err := c.GetVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "Title" || got.Description != "Description" || got.Visibility != VisibilityUnlisted || got.UserID != user.ID {
+			t.Errorf("GetVideo = %+v", got)
+		}
+
+		videos, err := c.GetVideos(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(videos) != 1 || videos[0].ID != video.ID {
+			t.Errorf("GetVideos = %+v, want just %s", videos, video.ID)
+		}
+
+		missing, err := c.GetVideo(uuid.New())
+		if err != nil || missing.ID != uuid.Nil {
+			t.Errorf("GetVideo(unknown) = %+v, %v; want zero video", missing, err)
+		}
+	})
+}
+
+func TestUpdateVideoIfVersion(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "version@example.com")
+		video := createTestVideo(t, c, user.ID, "Before", "", VisibilityPublic)
+
+		stale := video
+		video.Title = "After"
+		err := c.UpdateVideoIfVersion(video, video.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stale.Title = "Lost"
+		err = c.UpdateVideoIfVersion(stale, stale.Version)
+		if !errors.Is(err, ErrVideoConflict) {
+			t.Fatalf("saving a stale video gave %v, want ErrVideoConflict", err)
+		}
+		got, err := c.GetVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "After" || got.Version != video.Version+1 {
+			t.Errorf("video is %q at version %d, want After at %d", got.Title, got.Version, video.Version+1)
+		}
+
+		err = c.UpdateVideoIfVersion(Video{ID: uuid.New()}, 1)
+		if !errors.Is(err, ErrVideoConflict) {
+			t.Errorf("saving a missing video gave %v, want ErrVideoConflict", err)
+		}
+	})
+}
+
+func TestModifyVideoKeepsOtherColumns(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "modify@example.com")
+		video := createTestVideo(t, c, user.ID, "Title", "", VisibilityPublic)
+
+		// Another request saves while the change is being made
+		calls := 0
+		got, err := c.ModifyVideo(video.ID, func(v *Video) {
+			calls++
+			if calls == 1 {
+				other := *v
+				other.Title = "Renamed"
+				if err := c.UpdateVideo(other); err != nil {
+					t.Fatal(err)
+				}
+			}
+			v.Visibility = VisibilityPrivate
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calls != 2 {
+			t.Errorf("change ran %d times, want 2", calls)
+		}
+		if got.Title != "Renamed" || got.Visibility != VisibilityPrivate {
+			t.Errorf("ModifyVideo = %q/%s, want Renamed/private", got.Title, got.Visibility)
+		}
+
+		got, err = c.ModifyVideo(uuid.New(), func(*Video) {})
+		if err != nil || got.ID != uuid.Nil {
+			t.Errorf("ModifyVideo(unknown) = %+v, %v; want zero video", got, err)
+		}
+	})
+}
+
+func TestThumbnails(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "thumbs@example.com")
+		video := createTestVideo(t, c, user.ID, "Title", "", VisibilityPublic)
+
+		set, err := c.SetGeneratedThumbnail(video.ID, "http://example.com/gen.jpg", "gen/1.jpg", nil)
+		if err != nil || !set {
+			t.Fatalf("SetGeneratedThumbnail = %v, %v", set, err)
+		}
+		found, err := c.SetUploadedThumbnail(video.ID, "http://example.com/up.jpg", "up/1.jpg", nil)
+		if err != nil || !found {
+			t.Fatalf("SetUploadedThumbnail = %v, %v", found, err)
+		}
+
+		// A generated thumbnail never replaces an uploaded one
+		set, err = c.SetGeneratedThumbnail(video.ID, "http://example.com/gen2.jpg", "gen/2.jpg", nil)
+		if err != nil || set {
+			t.Fatalf("SetGeneratedThumbnail over an upload = %v, %v", set, err)
+		}
+		got, err := c.GetVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ThumbnailKey == nil || *got.ThumbnailKey != "up/1.jpg" || got.ThumbnailGenerated {
+			t.Errorf("thumbnail is %v (generated %v), want the upload", got.ThumbnailKey, got.ThumbnailGenerated)
+		}
+
+		tombstones, err := c.GetDueTombstones(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tombstones) != 1 || tombstones[0].Key != "gen/" {
+			t.Errorf("tombstones = %+v, want one for the replaced gen/ thumbnail", tombstones)
+		}
+
+		found, err = c.SetUploadedThumbnail(uuid.New(), "http://example.com/up.jpg", "up/2.jpg", nil)
+		if err != nil || found {
+			t.Errorf("SetUploadedThumbnail(unknown) = %v, %v; want false", found, err)
+		}
+	})
+}
+
+func TestDeleteVideoTombstonesObjects(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "delete@example.com")
+		video := createTestVideo(t, c, user.ID, "Title", "", VisibilityPublic)
+		video.VideoKey = ptr("landscape/abc.mp4")
+		video.HLSKey = ptr("landscape/abc/hls/master.m3u8")
+		err := c.UpdateVideo(video)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.DeleteVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.GetVideo(video.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != uuid.Nil {
+			t.Error("video survived DeleteVideo")
+		}
+
+		tombstones, err := c.GetDueTombstones(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := map[string]bool{}
+		for _, ts := range tombstones {
+			keys[ts.Key] = ts.Prefix
+		}
+		if prefix, ok := keys["landscape/abc.mp4"]; !ok || prefix {
+			t.Errorf("no tombstone for the MP4 in %+v", tombstones)
+		}
+		if prefix, ok := keys["landscape/abc/hls/"]; !ok || !prefix {
+			t.Errorf("no prefix tombstone for the HLS tree in %+v", tombstones)
+		}
+	})
+}
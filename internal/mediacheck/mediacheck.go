@@ -0,0 +1,211 @@
+// Package mediacheck validates uploaded media by its content rather than by
+// the type the client claims it has.
+package mediacheck
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/probe"
+	_ "golang.org/x/image/webp"
+)
+
+// SniffLen is how many leading bytes Sniff looks at.
+const SniffLen = 512
+
+// Rejection explains why an upload was refused. Code is stable for clients
+// to switch on. Actual is what was found and Limit what was allowed, where
+// they apply.
+type Rejection struct {
+	// Unsupported means the content isn't an accepted type at all, as
+	// opposed to an accepted type that fails a check.
+	Unsupported bool   `json:"-"`
+	Code        string `json:"code"`
+	Message     string `json:"error"`
+	Limit       any    `json:"limit,omitempty"`
+	Actual      any    `json:"actual,omitempty"`
+}
+
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+// Sniff identifies content from its leading bytes. Containers we may accept
+// are recognized here; anything else falls back to http.DetectContentType so
+// rejections can still say what the file looked like.
+func Sniff(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		return "image/jpeg"
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return "image/webp"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		// QuickTime files carry the "qt  " major brand
+		if string(head[8:12]) == "qt  " {
+			return "video/quicktime"
+		}
+		return "video/mp4"
+	case bytes.HasPrefix(head, []byte("\x1a\x45\xdf\xa3")):
+		// The EBML header names the doctype near the start
+		if bytes.Contains(head[:min(len(head), 64)], []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	}
+	mediaType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return mediaType
+}
+
+// ReadHead reads up to SniffLen bytes from r and rewinds it.
+func ReadHead(r io.ReadSeeker) ([]byte, error) {
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// genericTypes are what clients send when they don't know a file's type, so
+// they say nothing about the content.
+var genericTypes = []string{
+	"application/octet-stream",
+	"binary/octet-stream",
+	"application/unknown",
+}
+
+// CheckType sniffs head and returns its media type if it's one of allowed.
+// A declared type, when given and specific, must agree with the content.
+func CheckType(head []byte, declared string, allowed []string) (string, error) {
+	sniffed := Sniff(head)
+	if !slices.Contains(allowed, sniffed) {
+		return "", &Rejection{
+			Unsupported: true,
+			Code:        "unsupported_type",
+			Message:     fmt.Sprintf("Content is %s; accepted types are %s", sniffed, strings.Join(allowed, ", ")),
+			Limit:       allowed,
+			Actual:      sniffed,
+		}
+	}
+	if declared != "" && !slices.Contains(genericTypes, declared) && declared != sniffed {
+		return "", &Rejection{
+			Unsupported: true,
+			Code:        "type_mismatch",
+			Message:     fmt.Sprintf("Content is %s but was sent as %s", sniffed, declared),
+			Actual:      sniffed,
+		}
+	}
+	return sniffed, nil
+}
+
+type ImageLimits struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int
+}
+
+// CheckImage decodes just the image header and checks its dimensions, so
+// oversized images are refused before they're decoded in full anywhere.
+func CheckImage(r io.Reader, limits ImageLimits) (image.Config, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return image.Config{}, &Rejection{
+			Code:    "undecodable_image",
+			Message: fmt.Sprintf("Couldn't read image: %v", err),
+		}
+	}
+	size := fmt.Sprintf("%dx%d", config.Width, config.Height)
+	switch {
+	case config.Width <= 0 || config.Height <= 0:
+		return config, &Rejection{
+			Code:    "empty_image",
+			Message: "Image has no pixels",
+			Actual:  size,
+		}
+	case limits.MaxWidth > 0 && config.Width > limits.MaxWidth:
+		return config, &Rejection{
+			Code:    "image_too_wide",
+			Message: fmt.Sprintf("Image is %d pixels wide; the maximum is %d", config.Width, limits.MaxWidth),
+			Limit:   limits.MaxWidth,
+			Actual:  config.Width,
+		}
+	case limits.MaxHeight > 0 && config.Height > limits.MaxHeight:
+		return config, &Rejection{
+			Code:    "image_too_tall",
+			Message: fmt.Sprintf("Image is %d pixels tall; the maximum is %d", config.Height, limits.MaxHeight),
+			Limit:   limits.MaxHeight,
+			Actual:  config.Height,
+		}
+	case limits.MaxPixels > 0 && config.Width*config.Height > limits.MaxPixels:
+		return config, &Rejection{
+			Code:    "image_too_many_pixels",
+			Message: fmt.Sprintf("Image is %s, %d pixels; the maximum is %d", size, config.Width*config.Height, limits.MaxPixels),
+			Limit:   limits.MaxPixels,
+			Actual:  config.Width * config.Height,
+		}
+	}
+	return config, nil
+}
+
+type VideoLimits struct {
+	MaxDuration time.Duration
+	VideoCodecs []string
+	// AudioCodecs applies only to videos with sound.
+	AudioCodecs []string
+}
+
+// CheckVideo checks what ffprobe found in an upload.
+func CheckVideo(meta probe.Metadata, limits VideoLimits) error {
+	if meta.Video == nil {
+		return &Rejection{
+			Code:    "no_video_stream",
+			Message: "File has no video stream",
+		}
+	}
+	if meta.Duration <= 0 {
+		return &Rejection{
+			Code:    "unknown_duration",
+			Message: "Couldn't determine the video's duration",
+		}
+	}
+	duration := time.Duration(meta.Duration * float64(time.Second))
+	if limits.MaxDuration > 0 && duration > limits.MaxDuration {
+		return &Rejection{
+			Code:    "video_too_long",
+			Message: fmt.Sprintf("Video is %s long; the maximum is %s", duration.Round(time.Second), limits.MaxDuration),
+			Limit:   limits.MaxDuration.Seconds(),
+			Actual:  meta.Duration,
+		}
+	}
+	if len(limits.VideoCodecs) > 0 && !slices.Contains(limits.VideoCodecs, meta.Video.Codec) {
+		return &Rejection{
+			Code:    "video_codec_not_allowed",
+			Message: fmt.Sprintf("Video codec %s isn't accepted; use one of %s", meta.Video.Codec, strings.Join(limits.VideoCodecs, ", ")),
+			Limit:   limits.VideoCodecs,
+			Actual:  meta.Video.Codec,
+		}
+	}
+	if meta.Audio != nil && len(limits.AudioCodecs) > 0 && !slices.Contains(limits.AudioCodecs, meta.Audio.Codec) {
+		return &Rejection{
+			Code:    "audio_codec_not_allowed",
+			Message: fmt.Sprintf("Audio codec %s isn't accepted; use one of %s", meta.Audio.Codec, strings.Join(limits.AudioCodecs, ", ")),
+			Limit:   limits.AudioCodecs,
+			Actual:  meta.Audio.Codec,
+		}
+	}
+	return nil
+}
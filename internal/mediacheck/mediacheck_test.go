@@ -0,0 +1,186 @@
+package mediacheck
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/probe"
+)
+
+func rejectionCode(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var rejection *Rejection
+	if !errors.As(err, &rejection) {
+		t.Fatalf("error %v isn't a Rejection", err)
+	}
+	return rejection.Code
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"jpeg", "\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", "image/webp"},
+		{"mp4", "\x00\x00\x00\x20ftypisom\x00\x00\x02\x00", "video/mp4"},
+		{"quicktime", "\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00", "video/quicktime"},
+		{"webm", "\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm", "video/webm"},
+		{"matroska", "\x1a\x45\xdf\xa3\xa3\x42\x86\x81\x01\x42\x82\x88matroska", "video/x-matroska"},
+		{"riff without webp", "RIFF\x24\x00\x00\x00WAVEfmt ", "audio/wave"},
+		{"text", "hello, world", "text/plain"},
+		{"empty", "", "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sniff([]byte(tt.head))
+			if got != tt.want {
+				t.Errorf("Sniff() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadHead(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		want int
+	}{
+		{"short", 10, 10},
+		{"empty", 0, 0},
+		{"long", 2 * SniffLen, SniffLen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(bytes.Repeat([]byte("x"), tt.size))
+			head, err := ReadHead(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(head) != tt.want {
+				t.Errorf("read %d bytes, want %d", len(head), tt.want)
+			}
+			// The reader is rewound for whoever reads the whole file next
+			rest, _ := io.ReadAll(r)
+			if len(rest) != tt.size {
+				t.Errorf("%d bytes left after ReadHead, want %d", len(rest), tt.size)
+			}
+		})
+	}
+}
+
+func TestCheckType(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF")
+	allowed := []string{"image/jpeg", "image/png"}
+	tests := []struct {
+		name     string
+		head     []byte
+		declared string
+		wantCode string
+	}{
+		{"allowed", jpeg, "image/jpeg", ""},
+		{"nothing declared", jpeg, "", ""},
+		{"generic type declared", jpeg, "application/octet-stream", ""},
+		{"not allowed", []byte("GIF89a"), "image/gif", "unsupported_type"},
+		{"declared differently", jpeg, "image/png", "type_mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckType(tt.head, tt.declared, allowed)
+			if code := rejectionCode(t, err); code != tt.wantCode {
+				t.Fatalf("CheckType() rejection = %q, want %q", code, tt.wantCode)
+			}
+			if err == nil && got != "image/jpeg" {
+				t.Errorf("CheckType() = %s, want image/jpeg", got)
+			}
+		})
+	}
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckImage(t *testing.T) {
+	limits := ImageLimits{MaxWidth: 100, MaxHeight: 50, MaxPixels: 3000}
+	tests := []struct {
+		name     string
+		data     []byte
+		wantCode string
+	}{
+		{"within limits", encodePNG(t, 60, 40), ""},
+		{"too wide", encodePNG(t, 101, 10), "image_too_wide"},
+		{"too tall", encodePNG(t, 10, 51), "image_too_tall"},
+		{"too many pixels", encodePNG(t, 100, 31), "image_too_many_pixels"},
+		{"not an image", []byte("definitely not a PNG"), "undecodable_image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CheckImage(bytes.NewReader(tt.data), limits)
+			if code := rejectionCode(t, err); code != tt.wantCode {
+				t.Errorf("CheckImage() rejection = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+
+	// Zero limits allow any size
+	_, err := CheckImage(bytes.NewReader(encodePNG(t, 4000, 3000)), ImageLimits{})
+	if err != nil {
+		t.Errorf("CheckImage() without limits: %v", err)
+	}
+}
+
+func TestCheckVideo(t *testing.T) {
+	limits := VideoLimits{
+		MaxDuration: time.Minute,
+		VideoCodecs: []string{"h264", "hevc"},
+		AudioCodecs: []string{"aac"},
+	}
+	h264 := &probe.VideoStream{Codec: "h264", Width: 1920, Height: 1080}
+	tests := []struct {
+		name     string
+		meta     probe.Metadata
+		wantCode string
+	}{
+		{"accepted", probe.Metadata{Duration: 30, Video: h264, Audio: &probe.AudioStream{Codec: "aac"}}, ""},
+		{"silent", probe.Metadata{Duration: 30, Video: h264}, ""},
+		{"audio only", probe.Metadata{Duration: 30, Audio: &probe.AudioStream{Codec: "aac"}}, "no_video_stream"},
+		{"unknown duration", probe.Metadata{Video: h264}, "unknown_duration"},
+		{"too long", probe.Metadata{Duration: 61, Video: h264}, "video_too_long"},
+		{"video codec", probe.Metadata{Duration: 30, Video: &probe.VideoStream{Codec: "vp9"}}, "video_codec_not_allowed"},
+		{"audio codec", probe.Metadata{Duration: 30, Video: h264, Audio: &probe.AudioStream{Codec: "opus"}}, "audio_codec_not_allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckVideo(tt.meta, limits)
+			if code := rejectionCode(t, err); code != tt.wantCode {
+				t.Errorf("CheckVideo() rejection = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRejectionMessage(t *testing.T) {
+	err := CheckVideo(probe.Metadata{Duration: 90.4, Video: &probe.VideoStream{Codec: "h264"}}, VideoLimits{MaxDuration: time.Minute})
+	if err == nil || !strings.Contains(err.Error(), "1m30s long; the maximum is 1m0s") {
+		t.Errorf("CheckVideo() error = %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+var ErrNoVideoStream = errors.New("no video stream found")
+
+// Metadata is the typed result of running ffprobe on a media file.
+type Metadata struct {
+	Container string       `json:"container"`
+	Duration  float64      `json:"duration_seconds"`
+	BitRate   int64        `json:"bit_rate"`
+	Size      int64        `json:"size_bytes"`
+	Video     *VideoStream `json:"video"`
+	Audio     *AudioStream `json:"audio"`
+}
+
+type VideoStream struct {
+	Codec     string  `json:"codec"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	FrameRate float64 `json:"frame_rate"`
+	Rotation  int     `json:"rotation"`
+	BitRate   int64   `json:"bit_rate"`
+}
+
+type AudioStream struct {
+	Codec      string `json:"codec"`
+	Channels   int    `json:"channels"`
+	SampleRate int    `json:"sample_rate"`
+	BitRate    int64  `json:"bit_rate"`
+}
+
+// ffprobeOutput mirrors the parts of `ffprobe -print_format json` we read.
+// ffprobe reports most numbers as strings.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		BitRate      string            `json:"bit_rate"`
+		Channels     int               `json:"channels"`
+		SampleRate   string            `json:"sample_rate"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation *float64 `json:"rotation"`
+		} `json:"side_data_list"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+}
+
+// Probe runs ffprobe against filePath.
+func Probe(ctx context.Context, filePath string) (Metadata, error) {
+	cmd := exec.CommandContext(
+		ctx,
+		"ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		filePath,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return Metadata{}, fmt.Errorf("ffprobe failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return Parse(stdout.Bytes())
+}
+
+// Parse decodes ffprobe JSON output produced with -show_format -show_streams.
+func Parse(data []byte) (Metadata, error) {
+	out := ffprobeOutput{}
+	err := json.Unmarshal(data, &out)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("couldn't decode ffprobe output: %w", err)
+	}
+
+	m := Metadata{
+		Container: out.Format.FormatName,
+		Duration:  parseFloat(out.Format.Duration),
+		BitRate:   parseInt(out.Format.BitRate),
+		Size:      parseInt(out.Format.Size),
+	}
+	for _, stream := range out.Streams {
+		switch stream.CodecType {
+		case "video":
+			// Cover art shows up as a video stream too
+			if m.Video != nil || stream.Disposition.AttachedPic == 1 {
+				continue
+			}
+			frameRate := parseRational(stream.AvgFrameRate)
+			if frameRate == 0 {
+				frameRate = parseRational(stream.RFrameRate)
+			}
+			rotation := int(parseInt(stream.Tags["rotate"]))
+			for _, sd := range stream.SideDataList {
+				if sd.Rotation != nil {
+					rotation = int(*sd.Rotation)
+				}
+			}
+			m.Video = &VideoStream{
+				Codec:     stream.CodecName,
+				Width:     stream.Width,
+				Height:    stream.Height,
+				FrameRate: math.Round(frameRate*1000) / 1000,
+				Rotation:  normalizeRotation(rotation),
+				BitRate:   parseInt(stream.BitRate),
+			}
+		case "audio":
+			if m.Audio != nil {
+				continue
+			}
+			m.Audio = &AudioStream{
+				Codec:      stream.CodecName,
+				Channels:   stream.Channels,
+				SampleRate: int(parseInt(stream.SampleRate)),
+				BitRate:    parseInt(stream.BitRate),
+			}
+		}
+	}
+	return m, nil
+}
+
+// DisplayDimensions returns the size the video is shown at, which differs
+// from the coded size when the stream is rotated by 90 or 270 degrees.
+func (m Metadata) DisplayDimensions() (int, int, error) {
+	if m.Video == nil || m.Video.Width == 0 || m.Video.Height == 0 {
+		return 0, 0, ErrNoVideoStream
+	}
+	if m.Video.Rotation == 90 || m.Video.Rotation == 270 {
+		return m.Video.Height, m.Video.Width, nil
+	}
+	return m.Video.Width, m.Video.Height, nil
+}
+
+// AspectRatio classifies the display aspect ratio as "16:9", "9:16" or
+// "other", allowing for the odd pixel lost to encoder alignment.
+func (m Metadata) AspectRatio() (string, error) {
+	width, height, err := m.DisplayDimensions()
+	if err != nil {
+		return "", err
+	}
+
+	const tolerance = 0.02
+	ratio := float64(width) / float64(height)
+	switch {
+	case math.Abs(ratio-16.0/9.0) < tolerance:
+		return "16:9", nil
+	case math.Abs(ratio-9.0/16.0) < tolerance:
+		return "9:16", nil
+	default:
+		return "other", nil
+	}
+}
+
+func normalizeRotation(rotation int) int {
+	rotation %= 360
+	if rotation < 0 {
+		rotation += 360
+	}
+	return rotation
+}
+
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func parseInt(s string) int64 {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+// parseRational parses ffprobe's "30000/1001" style rates.
+func parseRational(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		return parseFloat(s)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return parseFloat(num) / d
+}
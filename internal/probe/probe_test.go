@@ -0,0 +1,134 @@
+package probe
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		fixture       string
+		want          Metadata
+		width, height int
+		aspect        string
+	}{
+		{
+			fixture: "landscape.json",
+			want: Metadata{
+				Container: "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:  62.5625,
+				BitRate:   4953061,
+				Size:      38734012,
+				Video:     &VideoStream{Codec: "h264", Width: 1920, Height: 1080, FrameRate: 29.97, BitRate: 4823118},
+				Audio:     &AudioStream{Codec: "aac", Channels: 2, SampleRate: 48000, BitRate: 128000},
+			},
+			width: 1920, height: 1080, aspect: "16:9",
+		},
+		{
+			// Rotation comes from the display matrix, and the frame rate
+			// falls back to r_frame_rate when the average is unknown
+			fixture: "portrait_side_data.json",
+			want: Metadata{
+				Container: "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:  12.016667,
+				BitRate:   11935659,
+				Size:      17928273,
+				Video:     &VideoStream{Codec: "hevc", Width: 1920, Height: 1080, FrameRate: 60, Rotation: 270, BitRate: 11934211},
+			},
+			width: 1080, height: 1920, aspect: "9:16",
+		},
+		{
+			fixture: "rotate_tag.json",
+			want: Metadata{
+				Container: "mov,mp4,m4a,3gp,3g2,mj2",
+				Duration:  4,
+				BitRate:   2097152,
+				Size:      1048576,
+				Video:     &VideoStream{Codec: "h264", Width: 1280, Height: 720, FrameRate: 25, Rotation: 270},
+			},
+			width: 720, height: 1280, aspect: "9:16",
+		},
+		{
+			// Cover art isn't a video stream
+			fixture: "audio_cover_art.json",
+			want: Metadata{
+				Container: "mp3",
+				Duration:  215.431837,
+				BitRate:   322087,
+				Size:      8673482,
+				Audio:     &AudioStream{Codec: "mp3", Channels: 2, SampleRate: 44100, BitRate: 320000},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, video %+v, audio %+v\nwant %+v, video %+v, audio %+v",
+					got, got.Video, got.Audio, tt.want, tt.want.Video, tt.want.Audio)
+			}
+
+			width, height, err := got.DisplayDimensions()
+			if tt.aspect == "" {
+				if !errors.Is(err, ErrNoVideoStream) {
+					t.Errorf("DisplayDimensions() error = %v, want ErrNoVideoStream", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if width != tt.width || height != tt.height {
+				t.Errorf("DisplayDimensions() = %dx%d, want %dx%d", width, height, tt.width, tt.height)
+			}
+			aspect, err := got.AspectRatio()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if aspect != tt.aspect {
+				t.Errorf("AspectRatio() = %s, want %s", aspect, tt.aspect)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidJSON(t *testing.T) {
+	_, err := Parse([]byte("ffprobe: not json"))
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestAspectRatio(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          string
+	}{
+		{1920, 1080, "16:9"},
+		// Encoders round odd sizes to even ones
+		{1366, 768, "16:9"},
+		{1080, 1920, "9:16"},
+		{1080, 1080, "other"},
+		{1440, 1080, "other"},
+	}
+	for _, tt := range tests {
+		m := Metadata{Video: &VideoStream{Width: tt.width, Height: tt.height}}
+		got, err := m.AspectRatio()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("AspectRatio(%dx%d) = %s, want %s", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type DiskStorage struct {
+	root    string
+	baseURL string
+}
+
+// NewDiskStorage stores objects as files below root. URLs are built from
+// baseURL, which should point at whatever serves root over HTTP.
+func NewDiskStorage(root, baseURL string) (*DiskStorage, error) {
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create storage root %s: %w", root, err)
+	}
+	return &DiskStorage{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (s *DiskStorage) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return fmt.Errorf("couldn't create directory for %s: %w", key, err)
+	}
+
+	// Write to a sibling temp file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return fmt.Errorf("couldn't create temp file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write %s: %w", key, err)
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't set permissions on %s: %w", key, err)
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *DiskStorage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, ObjectInfo{}, s.wrapErr(key, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, s.wrapErr(key, err)
+	}
+	return f, s.info(key, stat), nil
+}
+
+func (s *DiskStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return s.wrapErr(key, err)
+	}
+
+	// Prune directories left empty, e.g. after deleting an HLS tree. Remove
+	// fails on non-empty directories, which is where we stop.
+	for dir := filepath.Dir(p); dir != s.root && strings.HasPrefix(dir, s.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *DiskStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	stat, err := os.Stat(p)
+	if err != nil {
+		return ObjectInfo{}, s.wrapErr(key, err)
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return s.info(key, stat), nil
+}
+
+// List walks only the directory holding prefix, so listing one HLS tree
+// doesn't cost a walk of the whole root.
+func (s *DiskStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	// Whatever follows the last slash may be a partial file name
+	start := s.root
+	if dir, _ := path.Split(prefix); dir != "" {
+		var err error
+		start, err = s.path(strings.TrimSuffix(dir, "/"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	objects := []ObjectInfo{}
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == start && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".put-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, s.info(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list objects under %q: %w", prefix, err)
+	}
+	// Match S3's key order; the walk visits "a/b" before "a.mp4"
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (s *DiskStorage) URL(key string) string {
+	return fmt.Sprintf("%s/%s", s.baseURL, key)
+}
+
+// path maps a key onto the filesystem, refusing keys that would escape root.
+func (s *DiskStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned == "/" || cleaned[1:] != key {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *DiskStorage) info(key string, stat fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: stat.ModTime(),
+	}
+}
+
+func (s *DiskStorage) wrapErr(key string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return err
+}
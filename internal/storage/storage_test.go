@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// forEachBackend runs test against every backend that works without
+// credentials.
+func forEachBackend(t *testing.T, test func(t *testing.T, st Storage)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStorage("memory://test"))
+	})
+	t.Run("disk", func(t *testing.T) {
+		st, err := NewDiskStorage(t.TempDir(), "http://localhost/assets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, st)
+	})
+}
+
+func putObjects(t *testing.T, st Storage, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		err := st.Put(context.Background(), key, strings.NewReader(key), "video/mp4")
+		if err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+}
+
+func listKeys(t *testing.T, st Storage, prefix string) []string {
+	t.Helper()
+	objects, err := st.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatalf("list %q: %v", prefix, err)
+	}
+	keys := []string{}
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return keys
+}
+
+func TestPutGetStat(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Storage) {
+		ctx := context.Background()
+		putObjects(t, st, "landscape/abc.mp4")
+		// Overwrites replace the whole object
+		err := st.Put(ctx, "landscape/abc.mp4", strings.NewReader("second"), "video/mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, info, err := st.Get(ctx, "landscape/abc.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "second" {
+			t.Errorf("body = %q, want second", data)
+		}
+		if info.Key != "landscape/abc.mp4" || info.Size != 6 || info.ContentType != "video/mp4" {
+			t.Errorf("Get info = %+v", info)
+		}
+
+		stat, err := st.Stat(ctx, "landscape/abc.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat.Key != "landscape/abc.mp4" || stat.Size != 6 || stat.LastModified.IsZero() {
+			t.Errorf("Stat info = %+v", stat)
+		}
+	})
+}
+
+func TestMissingObjects(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Storage) {
+		ctx := context.Background()
+		putObjects(t, st, "landscape/abc.mp4")
+
+		tests := []struct {
+			name string
+			key  string
+		}{
+			{"missing object", "landscape/missing.mp4"},
+			{"missing directory", "portrait/abc.mp4"},
+			{"directory", "landscape"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := st.Stat(ctx, tt.key)
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("Stat = %v, want ErrNotFound", err)
+				}
+				if tt.key == "landscape" {
+					return
+				}
+				_, _, err = st.Get(ctx, tt.key)
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("Get = %v, want ErrNotFound", err)
+				}
+				// Deleting what isn't there succeeds
+				err = st.Delete(ctx, tt.key)
+				if err != nil {
+					t.Errorf("Delete = %v", err)
+				}
+			})
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Storage) {
+		ctx := context.Background()
+		putObjects(t, st, "landscape/abc/hls/master.m3u8", "landscape/abc/hls/720p/segment0.ts", "landscape/abc.mp4")
+
+		err := st.Delete(ctx, "landscape/abc/hls/720p/segment0.ts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = st.Stat(ctx, "landscape/abc/hls/720p/segment0.ts")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Stat after Delete = %v, want ErrNotFound", err)
+		}
+		got := listKeys(t, st, "")
+		want := []string{"landscape/abc.mp4", "landscape/abc/hls/master.m3u8"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("objects after Delete = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, st Storage) {
+		putObjects(t, st,
+			"landscape/abc.mp4",
+			"landscape/abc/hls/master.m3u8",
+			"landscape/abc/hls/720p/segment0.ts",
+			"landscape/abd.mp4",
+			"portrait/xyz.mp4",
+			"thumb.png",
+		)
+
+		tests := []struct {
+			name   string
+			prefix string
+			want   []string
+		}{
+			{"everything", "", []string{
+				"landscape/abc.mp4",
+				"landscape/abc/hls/720p/segment0.ts",
+				"landscape/abc/hls/master.m3u8",
+				"landscape/abd.mp4",
+				"portrait/xyz.mp4",
+				"thumb.png",
+			}},
+			{"directory", "landscape/abc/hls/", []string{
+				"landscape/abc/hls/720p/segment0.ts",
+				"landscape/abc/hls/master.m3u8",
+			}},
+			{"partial name", "landscape/ab", []string{
+				"landscape/abc.mp4",
+				"landscape/abc/hls/720p/segment0.ts",
+				"landscape/abc/hls/master.m3u8",
+				"landscape/abd.mp4",
+			}},
+			{"partial top-level name", "th", []string{"thumb.png"}},
+			{"missing directory", "square/", []string{}},
+			{"no match", "landscape/zzz", []string{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got := listKeys(t, st, tt.prefix)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("List(%q) = %v, want %v", tt.prefix, got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestDiskStorageRejectsEscapingKeys(t *testing.T) {
+	st, err := NewDiskStorage(t.TempDir(), "http://localhost/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"", "../outside.mp4", "/abs.mp4", "a/../../b.mp4", "a//b.mp4"} {
+		err := st.Put(ctx, key, strings.NewReader("x"), "")
+		if err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+	_, err = st.List(ctx, "../")
+	if err == nil {
+		t.Error("List(../) succeeded")
+	}
+}
@@ -0,0 +1,206 @@
+// Package thumbnail turns an uploaded or extracted image into resized
+// renditions. Images are fully decoded and re-encoded, so nothing from the
+// original file but its pixels survives.
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const jpegQuality = 85
+
+// Decode decodes a JPEG, PNG or WebP image and turns it upright according
+// to its EXIF orientation.
+func Decode(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return Orient(img, Orientation(data)), nil
+}
+
+// Orientation reads the EXIF orientation (1-8) from a JPEG, returning 1 when
+// there is none.
+func Orientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// Start of scan: the headers are over
+		if marker == 0xDA {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation finds the orientation tag in IFD0 of a TIFF structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+	return 1
+}
+
+// Orient applies an EXIF orientation, returning an upright image.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-dx, dy
+			case 3: // rotated 180°
+				sx, sy = w-1-dx, h-1-dy
+			case 4: // mirrored vertically
+				sx, sy = dx, h-1-dy
+			case 5: // transposed
+				sx, sy = dy, dx
+			case 6: // rotated 90° clockwise to display
+				sx, sy = dy, h-1-dx
+			case 7: // transversed
+				sx, sy = w-1-dy, h-1-dx
+			case 8: // rotated 90° counter-clockwise to display
+				sx, sy = w-1-dy, dx
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
+
+// Resize scales img to width, keeping its aspect ratio. A background, when
+// given, fills transparent areas for formats without alpha.
+func Resize(img image.Image, width int, background color.Color) *image.RGBA {
+	b := img.Bounds()
+	height := max(1, (b.Dy()*width+b.Dx()/2)/b.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if background != nil {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// Widths picks the rendition widths for an image sourceWidth wide. Images
+// are never enlarged; a source narrower than a configured width is used at
+// its own width instead.
+func Widths(configured []int, sourceWidth int) []int {
+	var widths []int
+	for _, w := range configured {
+		if w >= sourceWidth {
+			w = sourceWidth
+		}
+		if len(widths) == 0 || widths[len(widths)-1] < w {
+			widths = append(widths, w)
+		}
+	}
+	return widths
+}
+
+// Encode encodes img as "jpeg" or "webp". WebP goes through ffmpeg, as the
+// standard library can only decode it.
+func Encode(ctx context.Context, img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		return buf.Bytes(), err
+	case "webp":
+		// PNG keeps the pixels and alpha intact on the way to ffmpeg
+		var raw bytes.Buffer
+		err := (&png.Encoder{CompressionLevel: png.NoCompression}).Encode(&raw, img)
+		if err != nil {
+			return nil, err
+		}
+		var stderr strings.Builder
+		cmd := exec.CommandContext(ctx, "ffmpeg",
+			"-v", "error",
+			"-f", "image2pipe", "-i", "-",
+			"-map_metadata", "-1",
+			"-c:v", "libwebp", "-quality", "80",
+			"-f", "webp", "-",
+		)
+		cmd.Stdin = &raw
+		cmd.Stdout = &buf
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		if err != nil {
+			return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,206 @@
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withExifOrientation inserts an APP1 segment carrying orientation right
+// after the JPEG's start of image marker.
+func withExifOrientation(data []byte, order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+func TestOrientation(t *testing.T) {
+	plain := encodeJPEG(t, image.NewGray(image.Rect(0, 0, 8, 8)))
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", plain, 1},
+		{"little endian", withExifOrientation(plain, binary.LittleEndian, 6), 6},
+		{"big endian", withExifOrientation(plain, binary.BigEndian, 8), 8},
+		{"out of range", withExifOrientation(plain, binary.LittleEndian, 9), 1},
+		{"truncated", withExifOrientation(plain, binary.LittleEndian, 6)[:20], 1},
+		{"not a jpeg", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Orientation(tt.data)
+			if got != tt.want {
+				t.Errorf("Orientation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image with its stored top-left pixel marked
+	red := color.RGBA{R: 255, A: 255}
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, red)
+
+	tests := []struct {
+		orientation int
+		// Size and position of the marked pixel once upright
+		width, height int
+		x, y          int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+	for _, tt := range tests {
+		got := Orient(src, tt.orientation)
+		b := got.Bounds()
+		if b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.width, tt.height)
+			continue
+		}
+		if c := color.RGBAModel.Convert(got.At(tt.x, tt.y)); c != red {
+			t.Errorf("orientation %d: pixel (%d,%d) = %v, want the marked pixel", tt.orientation, tt.x, tt.y, c)
+		}
+	}
+}
+
+func TestDecodeAppliesOrientation(t *testing.T) {
+	data := withExifOrientation(encodeJPEG(t, image.NewGray(image.Rect(0, 0, 40, 20))), binary.BigEndian, 6)
+	img, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 40 {
+		t.Errorf("decoded %dx%d, want 20x40", b.Dx(), b.Dy())
+	}
+
+	_, err = Decode([]byte("not an image"))
+	if err == nil {
+		t.Error("expected an error for undecodable data")
+	}
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		to            int
+		wantHeight    int
+	}{
+		{"landscape", 1920, 1080, 640, 360},
+		{"portrait", 1080, 1920, 320, 569},
+		// Very wide images still keep a row of pixels
+		{"panorama", 4000, 2, 100, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resize(image.NewGray(image.Rect(0, 0, tt.width, tt.height)), tt.to, nil)
+			if b := got.Bounds(); b.Dx() != tt.to || b.Dy() != tt.wantHeight {
+				t.Errorf("Resize() = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.to, tt.wantHeight)
+			}
+		})
+	}
+
+	// Transparent areas take the background colour
+	transparent := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	got := Resize(transparent, 10, color.White)
+	if c := color.RGBAModel.Convert(got.At(5, 5)); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("background pixel = %v, want white", c)
+	}
+}
+
+func TestWidths(t *testing.T) {
+	tests := []struct {
+		name        string
+		configured  []int
+		sourceWidth int
+		want        []int
+	}{
+		{"wide source", []int{320, 640, 1280}, 1920, []int{320, 640, 1280}},
+		{"between widths", []int{320, 640, 1280}, 800, []int{320, 640, 800}},
+		{"narrower than all", []int{320, 640, 1280}, 200, []int{200}},
+		{"exact width", []int{320, 640}, 640, []int{320, 640}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Widths(tt.configured, tt.sourceWidth)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Widths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	tests := []string{"jpeg", "webp"}
+	for _, format := range tests {
+		t.Run(format, func(t *testing.T) {
+			if format == "webp" {
+				if _, err := exec.LookPath("ffmpeg"); err != nil {
+					t.Skip("ffmpeg isn't installed")
+				}
+			}
+			data, err := Encode(context.Background(), img, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := decoded.Bounds(); b.Dx() != 32 || b.Dy() != 16 {
+				t.Errorf("round trip gave %dx%d, want 32x16", b.Dx(), b.Dy())
+			}
+		})
+	}
+
+	_, err := Encode(context.Background(), img, "gif")
+	if err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mediacheck"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/probe"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	jobTypeProcessVideo        = "process_video"
+	processVideoJobMaxAttempts = 5
+)
+
+// processVideoPayload names the uploaded file to process: either a local
+// file in the spool directory or an object already in video storage, as left
+// by a direct upload.
+type processVideoPayload struct {
+	SourcePath string `json:"source_path,omitempty"`
+	SourceKey  string `json:"source_key,omitempty"`
+	MediaType  string `json:"media_type"`
+}
+
+// enqueueProcessVideo queues processing for an upload. A non-empty dedupeKey
+// identifies the upload, so enqueueing it twice returns the first job.
+func (cfg *apiConfig) enqueueProcessVideo(userID, videoID uuid.UUID, payload processVideoPayload, dedupeKey string) (database.Job, error) {
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		return database.Job{}, err
+	}
+	return cfg.db.EnqueueJob(database.EnqueueJobParams{
+		Type:        jobTypeProcessVideo,
+		UserID:      userID,
+		VideoID:     &videoID,
+		Payload:     dat,
+		MaxAttempts: processVideoJobMaxAttempts,
+		DedupeKey:   dedupeKey,
+	})
+}
+
+func (cfg *apiConfig) handleProcessVideoJob(ctx context.Context, job database.Job, progress func(int)) (err error) {
+	var payload processVideoPayload
+	err = json.Unmarshal(job.Payload, &payload)
+	if err != nil {
+		return permanent(fmt.Errorf("invalid payload: %w", err))
+	}
+	if job.VideoID == nil {
+		return permanent(errors.New("job has no video"))
+	}
+
+	// The upload has to outlive failed attempts so they can be retried
+	defer func() {
+		var perm permanentError
+		if err == nil || errors.As(err, &perm) || job.Attempts >= job.MaxAttempts {
+			cfg.discardVideoSource(payload)
+		}
+	}()
+
+	sourcePath := payload.SourcePath
+	if payload.SourceKey != "" {
+		sourcePath, err = cfg.downloadVideoSource(ctx, payload.SourceKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			return permanent(fmt.Errorf("uploaded object is gone: %w", err))
+		}
+		if err != nil {
+			return err
+		}
+		defer os.Remove(sourcePath)
+	} else if _, statErr := os.Stat(sourcePath); statErr != nil {
+		return permanent(fmt.Errorf("uploaded file is gone: %w", statErr))
+	}
+
+	video, err := cfg.db.GetVideo(*job.VideoID)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		return permanent(errors.New("video no longer exists"))
+	}
+	progress(10)
+
+	// Resumable and direct uploads weren't checked when they arrived
+	mediaType, err := cfg.checkVideoType(sourcePath)
+	var rejection *mediacheck.Rejection
+	if errors.As(err, &rejection) {
+		return permanent(fmt.Errorf("%s: %w", rejection.Code, rejection))
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read video: %w", err)
+	}
+	meta, err := cfg.checkVideoFile(ctx, sourcePath)
+	if errors.As(err, &rejection) {
+		return permanent(fmt.Errorf("%s: %w", rejection.Code, rejection))
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't probe video: %w", err)
+	}
+	progress(15)
+
+	var transcode *database.VideoTranscode
+	if needsTranscode(mediaType, meta) {
+		transcodedPath, err := cfg.transcodeVideo(ctx, sourcePath, meta)
+		if err != nil {
+			return fmt.Errorf("couldn't transcode video: %w", err)
+		}
+		defer os.Remove(transcodedPath)
+		transcode = &database.VideoTranscode{
+			TranscodeProfile: cfg.transcodeProfile,
+			SourceType:       mediaType,
+			SourceVideoCodec: meta.Video.Codec,
+		}
+		if meta.Audio != nil {
+			transcode.SourceAudioCodec = &meta.Audio.Codec
+		}
+		sourcePath = transcodedPath
+		meta, err = probe.Probe(ctx, sourcePath)
+		if err != nil {
+			return fmt.Errorf("couldn't probe transcoded video: %w", err)
+		}
+	}
+	aspectRatio, err := meta.AspectRatio()
+	if err != nil {
+		return permanent(err)
+	}
+	prefix := "other"
+	switch aspectRatio {
+	case "16:9":
+		prefix = "landscape"
+	case "9:16":
+		prefix = "portrait"
+	}
+	progress(25)
+
+	processedPath, err := processVideoForFastStart(sourcePath)
+	if err != nil {
+		return fmt.Errorf("couldn't process video: %w", err)
+	}
+	defer os.Remove(processedPath)
+	progress(60)
+
+	processedFile, err := os.Open(processedPath)
+	if err != nil {
+		return fmt.Errorf("couldn't open processed video: %w", err)
+	}
+	defer processedFile.Close()
+
+	randomBytes := make([]byte, 32)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	// Whatever came in, faststart leaves an MP4
+	key := fmt.Sprintf("%s/%s.mp4", prefix, base64.RawURLEncoding.EncodeToString(randomBytes))
+
+	err = cfg.videoStorage.Put(ctx, key, processedFile, "video/mp4")
+	if err != nil {
+		return fmt.Errorf("couldn't store video: %w", err)
+	}
+	// Until the row points at them, nothing else knows these objects exist
+	saved := false
+	defer func() {
+		if !saved {
+			cfg.deleteStoredObjects(context.Background(), cfg.videoStorage, key, false)
+			cfg.deleteStoredObjects(context.Background(), cfg.videoStorage, hlsKeyPrefix(key)+"/", true)
+		}
+	}()
+	progress(65)
+
+	var hlsKey *string
+	if len(cfg.hlsLadder) > 0 {
+		masterKey, err := cfg.packageHLS(ctx, processedPath, hlsKeyPrefix(key), meta)
+		if err != nil {
+			return err
+		}
+		hlsKey = &masterKey
+	}
+	progress(90)
+
+	// Edits made while we were processing are kept; only the files change
+	video, err = cfg.db.ModifyVideo(video.ID, func(v *database.Video) {
+		v.VideoKey = &key
+		v.HLSKey = hlsKey
+		v.VideoURL = nil
+		v.HLSURL = nil
+		cfg.applyVideoVisibility(v)
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't update video: %w", err)
+	}
+	if video.ID == uuid.Nil {
+		return permanent(errors.New("video was deleted while processing"))
+	}
+	saved = true
+
+	media := videoMediaFromProbe(meta)
+	media.Aspect = prefix
+	media.Transcode = transcode
+	err = cfg.db.UpsertVideoMedia(video.ID, media)
+	if err != nil {
+		return fmt.Errorf("couldn't save media metadata: %w", err)
+	}
+
+	cfg.generateThumbnail(ctx, video.ID, processedPath, meta)
+	return nil
+}
+
+// downloadVideoSource copies a directly uploaded object into the spool
+// directory, since ffmpeg needs a seekable local file.
+func (cfg *apiConfig) downloadVideoSource(ctx context.Context, key string) (string, error) {
+	body, _, err := cfg.videoStorage.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	f, err := os.CreateTemp(cfg.spoolDir, "tubely-direct-*"+path.Ext(key))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, body)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("couldn't download %s: %w", key, err)
+	}
+	return f.Name(), nil
+}
+
+// discardVideoSource removes the original upload once it's no longer needed.
+func (cfg *apiConfig) discardVideoSource(payload processVideoPayload) {
+	if payload.SourcePath != "" {
+		os.Remove(payload.SourcePath)
+	}
+	if payload.SourceKey != "" {
+		err := cfg.videoStorage.Delete(context.Background(), payload.SourceKey)
+		if err != nil {
+			log.Printf("couldn't delete uploaded object %s: %v", payload.SourceKey, err)
+		}
+	}
+}
+
+func videoMediaFromProbe(meta probe.Metadata) database.VideoMedia {
+	media := database.VideoMedia{
+		Container: meta.Container,
+		Duration:  meta.Duration,
+		BitRate:   meta.BitRate,
+		SizeBytes: meta.Size,
+	}
+	if meta.Video != nil {
+		media.VideoCodec = meta.Video.Codec
+		media.Width = meta.Video.Width
+		media.Height = meta.Video.Height
+		media.FrameRate = meta.Video.FrameRate
+		media.Rotation = meta.Video.Rotation
+	}
+	if meta.Audio != nil {
+		media.AudioCodec = &meta.Audio.Codec
+	}
+	return media
+}
+
+// packageHLS transcodes filePath into the configured ladder and uploads the
+// result under keyPrefix, returning the master playlist key.
+func (cfg *apiConfig) packageHLS(ctx context.Context, filePath, keyPrefix string, meta probe.Metadata) (string, error) {
+	width, height, err := meta.DisplayDimensions()
+	if err != nil {
+		return "", err
+	}
+
+	outDir, err := os.MkdirTemp(cfg.spoolDir, "hls-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(outDir)
+
+	rungs := selectHLSRungs(cfg.hlsLadder, width, height)
+	err = transcodeHLS(ctx, filePath, outDir, rungs, width, height, meta.Audio != nil)
+	if err != nil {
+		return "", fmt.Errorf("couldn't package HLS: %w", err)
+	}
+	return cfg.uploadHLSTree(ctx, outDir, keyPrefix)
+}
@@ -1,19 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
-    "context"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/cdn"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mediacheck"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 	//"github.com/google/uuid"
 
     "github.com/aws/aws-sdk-go-v2/service/s3"
-    "github.com/aws/aws-sdk-go-v2/config"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
@@ -27,6 +35,19 @@ type apiConfig struct {
 	s3Region         string
 	s3CfDistribution string
 	port             string
+	videoStorage     storage.Storage
+	thumbnailStorage storage.Storage
+	spoolDir         string
+	hlsLadder        []hlsRung
+	autoThumbnail    autoThumbnailConfig
+	thumbnailRenditions thumbnailRenditionConfig
+	uploadLocks      *uploadLocks
+	videoURLExpiry   time.Duration
+	cdnSigner        *cdn.Signer
+	videoTypes       []string
+	videoLimits      mediacheck.VideoLimits
+	transcodeProfile database.TranscodeProfile
+	imageLimits      mediacheck.ImageLimits
 }
 
 type thumbnail struct {
@@ -39,9 +60,14 @@ type thumbnail struct {
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
+	// DB_URL takes a postgres:// URL or a SQLite path; DB_PATH is the older
+	// SQLite-only name
+	pathToDB := os.Getenv("DB_URL")
 	if pathToDB == "" {
-		log.Fatal("DB_URL must be set")
+		pathToDB = os.Getenv("DB_PATH")
+	}
+	if pathToDB == "" {
+		log.Fatal("DB_URL or DB_PATH must be set")
 	}
 
 	db, err := database.NewClient(pathToDB)
@@ -49,6 +75,24 @@ func main() {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
+	// migrate only needs the database, so it runs before the rest of the
+	// configuration is required
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(db, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = db.MigrateUp()
+	if errors.Is(err, database.ErrSchemaAhead) {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+	if err != nil {
+		log.Fatalf("Couldn't migrate database: %v", err)
+	}
+
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
@@ -69,26 +113,37 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
-    s3Client_cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-        log.Fatalf("S3_CLIENT failed to load configuration: %v", err)
+	videoStorageKind := os.Getenv("VIDEO_STORAGE")
+	if videoStorageKind == "" {
+		videoStorageKind = storageBackendS3
 	}
 
-    s3Client := s3.NewFromConfig(s3Client_cfg)
-
-	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		log.Fatal("S3_BUCKET environment variable is not set")
+	thumbnailStorageKind := os.Getenv("THUMBNAIL_STORAGE")
+	if thumbnailStorageKind == "" {
+		thumbnailStorageKind = storageBackendDisk
 	}
 
+	// S3 settings are only needed when one of the backends lives in S3,
+	// which lets CI run the whole server offline.
+	var s3Client *s3.Client
+	s3Bucket := os.Getenv("S3_BUCKET")
 	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
-		log.Fatal("S3_REGION environment variable is not set")
-	}
-
 	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
+	if videoStorageKind == storageBackendS3 || thumbnailStorageKind == storageBackendS3 {
+		if s3Bucket == "" {
+			log.Fatal("S3_BUCKET environment variable is not set")
+		}
+		if s3Region == "" {
+			log.Fatal("S3_REGION environment variable is not set")
+		}
+		if s3CfDistribution == "" {
+			log.Fatal("S3_CF_DISTRO environment variable is not set")
+		}
+
+		s3Client, err = newS3Client(s3Region)
+		if err != nil {
+			log.Fatalf("S3_CLIENT failed to load configuration: %v", err)
+		}
 	}
 
 	port := os.Getenv("PORT")
@@ -96,6 +151,100 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	spoolDir := os.Getenv("SPOOL_DIR")
+	if spoolDir == "" {
+		spoolDir = filepath.Join(os.TempDir(), "tubely-spool")
+	}
+	err = os.MkdirAll(spoolDir, 0755)
+	if err != nil {
+		log.Fatalf("Couldn't create spool directory: %v", err)
+	}
+
+	jobWorkers := 2
+	if s := os.Getenv("JOB_WORKERS"); s != "" {
+		jobWorkers, err = strconv.Atoi(s)
+		if err != nil || jobWorkers < 0 {
+			log.Fatalf("JOB_WORKERS must be a non-negative integer, got %q", s)
+		}
+	}
+
+	hlsLadder, err := parseHLSLadder(os.Getenv("HLS_LADDER"))
+	if err != nil {
+		log.Fatalf("HLS_LADDER is invalid: %v", err)
+	}
+
+	autoThumbnail, err := parseAutoThumbnailConfig(
+		os.Getenv("THUMBNAIL_AUTO_MODE"),
+		os.Getenv("THUMBNAIL_AUTO_OFFSET"),
+		os.Getenv("THUMBNAIL_AUTO_FORMAT"),
+	)
+	if err != nil {
+		log.Fatalf("Invalid automatic thumbnail settings: %v", err)
+	}
+
+	thumbnailRenditions, err := parseThumbnailRenditionConfig(
+		os.Getenv("THUMBNAIL_WIDTHS"),
+		os.Getenv("THUMBNAIL_FORMATS"),
+	)
+	if err != nil {
+		log.Fatalf("Invalid thumbnail rendition settings: %v", err)
+	}
+
+	videoTypes, err := parseVideoTypes(os.Getenv("VIDEO_TYPES"))
+	if err != nil {
+		log.Fatalf("Invalid VIDEO_TYPES: %v", err)
+	}
+
+	transcodeProfile, err := parseTranscodeProfile(
+		os.Getenv("TRANSCODE_CRF"),
+		os.Getenv("TRANSCODE_PRESET"),
+		os.Getenv("TRANSCODE_MAX_RESOLUTION"),
+		os.Getenv("TRANSCODE_AUDIO_BITRATE"),
+	)
+	if err != nil {
+		log.Fatalf("Invalid transcoding profile: %v", err)
+	}
+
+	videoLimits, err := parseVideoLimits(
+		os.Getenv("VIDEO_MAX_DURATION"),
+		os.Getenv("VIDEO_CODECS"),
+		os.Getenv("AUDIO_CODECS"),
+	)
+	if err != nil {
+		log.Fatalf("Invalid video upload limits: %v", err)
+	}
+
+	imageLimits, err := parseImageLimits(
+		os.Getenv("THUMBNAIL_MAX_DIMENSION"),
+		os.Getenv("THUMBNAIL_MAX_PIXELS"),
+	)
+	if err != nil {
+		log.Fatalf("Invalid thumbnail upload limits: %v", err)
+	}
+
+	videoURLExpiry := 15 * time.Minute
+	if s := os.Getenv("VIDEO_URL_EXPIRY"); s != "" {
+		videoURLExpiry, err = time.ParseDuration(s)
+		if err != nil || videoURLExpiry <= 0 {
+			log.Fatalf("VIDEO_URL_EXPIRY must be a positive duration, got %q", s)
+		}
+	}
+
+	// CloudFront signing is optional. Without it private videos fall back to
+	// presigned S3 URLs and can't be streamed over HLS.
+	var cdnSigner *cdn.Signer
+	cfKeyPairID := os.Getenv("CF_KEY_PAIR_ID")
+	cfPrivateKeyPath := os.Getenv("CF_PRIVATE_KEY_PATH")
+	if cfKeyPairID != "" || cfPrivateKeyPath != "" {
+		if videoStorageKind != storageBackendS3 {
+			log.Fatal("CF_KEY_PAIR_ID and CF_PRIVATE_KEY_PATH need VIDEO_STORAGE=s3")
+		}
+		cdnSigner, err = cdn.NewSigner(cfKeyPairID, cfPrivateKeyPath, os.Getenv("CF_COOKIE_DOMAIN"))
+		if err != nil {
+			log.Fatalf("Couldn't load CloudFront key pair: %v", err)
+		}
+	}
+
 	cfg := apiConfig{
 		db:               db,
 		jwtSecret:        jwtSecret,
@@ -107,6 +256,17 @@ func main() {
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
 		port:             port,
+		spoolDir:         spoolDir,
+		hlsLadder:        hlsLadder,
+		autoThumbnail:    autoThumbnail,
+		thumbnailRenditions: thumbnailRenditions,
+		uploadLocks:      &uploadLocks{},
+		videoURLExpiry:   videoURLExpiry,
+		cdnSigner:        cdnSigner,
+		videoTypes:       videoTypes,
+		videoLimits:      videoLimits,
+		transcodeProfile: transcodeProfile,
+		imageLimits:      imageLimits,
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -114,6 +274,29 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	err = os.MkdirAll(cfg.tusDir(), 0755)
+	if err != nil {
+		log.Fatalf("Couldn't create upload directory: %v", err)
+	}
+
+	cfg.videoStorage, err = cfg.newStorage(videoStorageKind, "videos")
+	if err != nil {
+		log.Fatalf("Couldn't set up video storage: %v", err)
+	}
+
+	cfg.thumbnailStorage, err = cfg.newStorage(thumbnailStorageKind, "")
+	if err != nil {
+		log.Fatalf("Couldn't set up thumbnail storage: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		err = cfg.runCommand(context.Background(), os.Args[1], os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
@@ -127,21 +310,81 @@ func main() {
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
 
-	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
-	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
-	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
-	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
-	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("POST /api/api_keys", cfg.require(sessionOnly, cfg.handlerAPIKeyCreate))
+	mux.HandleFunc("GET /api/api_keys", cfg.require(sessionOnly, cfg.handlerAPIKeysRetrieve))
+	mux.HandleFunc("PATCH /api/api_keys/{keyID}", cfg.require(sessionOnly, cfg.handlerAPIKeyUpdate))
+	mux.HandleFunc("DELETE /api/api_keys/{keyID}", cfg.require(sessionOnly, cfg.handlerAPIKeyDelete))
+
+	mux.HandleFunc("GET /api/sessions", cfg.require(sessionOnly, cfg.handlerSessionsRetrieve))
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.require(sessionOnly, cfg.handlerSessionDelete))
+	mux.HandleFunc("POST /api/sessions/revoke_others", cfg.require(sessionOnly, cfg.handlerSessionsRevokeOthers))
+
+	mux.HandleFunc("POST /api/videos", cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerVideoMetaCreate))
+	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.require(ownerOfVideo, cfg.handlerUploadThumbnail))
+	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.require(ownerOfVideo, cfg.handlerUploadVideo))
+	mux.HandleFunc("POST /api/video_upload/{videoID}/multipart", cfg.require(ownerOfVideo, cfg.handlerDirectUploadCreate))
+	mux.HandleFunc("POST /api/video_upload/{videoID}/multipart/complete", cfg.require(ownerOfVideo, cfg.handlerDirectUploadComplete))
+	mux.HandleFunc("DELETE /api/video_upload/{videoID}/multipart", cfg.require(ownerOfVideo, cfg.handlerDirectUploadAbort))
+	mux.HandleFunc("GET /api/videos", cfg.require(authenticated(auth.ScopeVideosRead), cfg.handlerVideosRetrieve))
+	mux.HandleFunc("GET /api/videos/search", cfg.require(authenticated(auth.ScopeVideosRead), cfg.handlerVideosSearch))
+	mux.HandleFunc("GET /api/videos/{videoID}", cfg.require(anonymous, cfg.handlerVideoGet))
 	//mux.HandleFunc("GET /api/thumbnails/{videoID}", cfg.handlerThumbnailGet)
-	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.require(ownerOfVideo, cfg.handlerVideoMetaDelete))
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.require(ownerOfVideo, cfg.handlerVideoUpdate))
+	mux.HandleFunc("PUT /api/videos/{videoID}/visibility", cfg.require(ownerOfVideo, cfg.handlerVideoVisibilityUpdate))
+	mux.HandleFunc("POST /api/videos/{videoID}/cdn_cookies", cfg.require(anonymous, cfg.handlerCDNCookies))
+	mux.HandleFunc("GET /api/videos/{videoID}/tags", cfg.require(anonymous, cfg.handlerVideoTagsGet))
+	mux.HandleFunc("POST /api/videos/{videoID}/tags", cfg.require(ownerOfVideo, cfg.handlerVideoTagsAdd))
+	mux.HandleFunc("DELETE /api/videos/{videoID}/tags/{tag}", cfg.require(ownerOfVideo, cfg.handlerVideoTagDelete))
+	mux.HandleFunc("GET /api/tags", cfg.require(authenticated(auth.ScopeVideosRead), cfg.handlerTagsSuggest))
+
+	mux.HandleFunc("POST /api/playlists", cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerPlaylistCreate))
+	mux.HandleFunc("GET /api/playlists", cfg.require(authenticated(auth.ScopeVideosRead), cfg.handlerPlaylistsRetrieve))
+	mux.HandleFunc("GET /api/playlists/{playlistID}", cfg.require(anonymous, cfg.handlerPlaylistGet))
+	mux.HandleFunc("PATCH /api/playlists/{playlistID}", cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerPlaylistUpdate))
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}", cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerPlaylistDelete))
+	mux.HandleFunc("POST /api/playlists/{playlistID}/items", cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerPlaylistItemAdd))
+	mux.HandleFunc("PUT /api/playlists/{playlistID}/items", cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerPlaylistReorder))
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}/items/{videoID}", cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerPlaylistItemDelete))
+	mux.HandleFunc("POST /api/playlists/{playlistID}/items/{videoID}/move", cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerPlaylistItemMove))
+
+	mux.HandleFunc("GET /api/jobs/{jobID}", cfg.require(authenticated(auth.ScopeVideosRead), cfg.handlerJobGet))
 
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("OPTIONS /api/uploads", tusMiddleware(cfg.handlerTusOptions))
+	mux.HandleFunc("OPTIONS /api/uploads/{uploadID}", tusMiddleware(cfg.handlerTusOptions))
+	mux.HandleFunc("POST /api/uploads", tusMiddleware(cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerTusCreate)))
+	mux.HandleFunc("HEAD /api/uploads/{uploadID}", tusMiddleware(cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerTusHead)))
+	mux.HandleFunc("PATCH /api/uploads/{uploadID}", tusMiddleware(cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerTusPatch)))
+	mux.HandleFunc("DELETE /api/uploads/{uploadID}", tusMiddleware(cfg.require(authenticated(auth.ScopeVideosWrite), cfg.handlerTusDelete)))
+
+	mux.HandleFunc("POST /admin/reset", cfg.require(admin(auth.PermResetDatabase), cfg.handlerReset))
+	mux.HandleFunc("GET /admin/users", cfg.require(admin(auth.PermListUsers), cfg.handlerAdminUsersList))
+	mux.HandleFunc("POST /admin/users/{userID}/disable", cfg.require(admin(auth.PermManageUsers), cfg.handlerAdminUserDisable))
+	mux.HandleFunc("DELETE /admin/users/{userID}/disable", cfg.require(admin(auth.PermManageUsers), cfg.handlerAdminUserEnable))
+	mux.HandleFunc("PUT /admin/users/{userID}/role", cfg.require(admin(auth.PermManageUsers), cfg.handlerAdminUserRoleUpdate))
+	mux.HandleFunc("GET /admin/videos/{videoID}", cfg.require(admin(auth.PermViewAnyVideo), cfg.handlerAdminVideoGet))
+	mux.HandleFunc("DELETE /admin/videos/{videoID}", cfg.require(admin(auth.PermDeleteAnyVideo), cfg.handlerAdminVideoDelete))
 
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: mux,
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workers := cfg.startWorkers(ctx, jobWorkers)
+	go cfg.sweepExpiredUploads(ctx)
+	go cfg.sweepTombstones(ctx)
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
 	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	workers.Wait()
 }
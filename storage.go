@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+const (
+	storageBackendS3     = "s3"
+	storageBackendDisk   = "disk"
+	storageBackendMemory = "memory"
+)
+
+// newStorage builds the backend named by kind. Disk and memory backends are
+// served from /assets so their URLs stay valid when running offline.
+func (cfg *apiConfig) newStorage(kind, subdir string) (storage.Storage, error) {
+	switch kind {
+	case storageBackendS3:
+		if cfg.s3Client == nil {
+			return nil, fmt.Errorf("s3 storage selected but no S3 client is configured")
+		}
+		return storage.NewS3Storage(cfg.s3Client, cfg.s3Bucket, cfg.s3CfDistribution), nil
+	case storageBackendDisk:
+		baseURL := fmt.Sprintf("http://localhost:%s/assets", cfg.port)
+		root := cfg.assetsRoot
+		if subdir != "" {
+			root = filepath.Join(root, subdir)
+			baseURL = fmt.Sprintf("%s/%s", baseURL, subdir)
+		}
+		return storage.NewDiskStorage(root, baseURL)
+	case storageBackendMemory:
+		return storage.NewMemoryStorage("memory://" + subdir), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", kind)
+	}
+}
+
+func newS3Client(region string) (*s3.Client, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(awsCfg), nil
+}
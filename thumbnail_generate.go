@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/probe"
+	thumb "github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/thumbnail"
+	"github.com/google/uuid"
+)
+
+const (
+	autoThumbnailModeScene  = "scene"
+	autoThumbnailModeOffset = "offset"
+	autoThumbnailModeOff    = "off"
+
+	// sceneChangeThreshold is how different a frame must be from the previous
+	// one (0-1) to count as a scene change.
+	sceneChangeThreshold = 0.3
+)
+
+type autoThumbnailConfig struct {
+	Mode   string
+	Offset time.Duration
+	Format string
+}
+
+func parseAutoThumbnailConfig(mode, offset, format string) (autoThumbnailConfig, error) {
+	c := autoThumbnailConfig{
+		Mode:   autoThumbnailModeScene,
+		Offset: 3 * time.Second,
+		Format: "jpeg",
+	}
+	if mode != "" {
+		c.Mode = mode
+	}
+	switch c.Mode {
+	case autoThumbnailModeScene, autoThumbnailModeOffset, autoThumbnailModeOff:
+	default:
+		return autoThumbnailConfig{}, fmt.Errorf("unknown mode %q", mode)
+	}
+	if offset != "" {
+		d, err := time.ParseDuration(offset)
+		if err != nil || d < 0 {
+			return autoThumbnailConfig{}, fmt.Errorf("invalid offset %q", offset)
+		}
+		c.Offset = d
+	}
+	if format != "" {
+		c.Format = format
+	}
+	if c.Format != "jpeg" && c.Format != "webp" {
+		return autoThumbnailConfig{}, fmt.Errorf("unsupported format %q", format)
+	}
+	return c, nil
+}
+
+// thumbnailRenditionConfig says which sizes and formats every thumbnail is
+// stored in.
+type thumbnailRenditionConfig struct {
+	Widths  []int
+	Formats []string
+}
+
+func parseThumbnailRenditionConfig(widths, formats string) (thumbnailRenditionConfig, error) {
+	c := thumbnailRenditionConfig{
+		Widths:  []int{160, 320, 640, 1280},
+		Formats: []string{"jpeg"},
+	}
+	if widths != "" {
+		c.Widths = nil
+		for _, item := range splitList(widths) {
+			n, err := strconv.Atoi(item)
+			if err != nil || n <= 0 {
+				return thumbnailRenditionConfig{}, fmt.Errorf("invalid width %q", item)
+			}
+			c.Widths = append(c.Widths, n)
+		}
+		slices.Sort(c.Widths)
+		c.Widths = slices.Compact(c.Widths)
+	}
+	if formats != "" {
+		c.Formats = splitList(formats)
+	}
+	if len(c.Widths) == 0 || len(c.Formats) == 0 {
+		return thumbnailRenditionConfig{}, errors.New("at least one width and format is required")
+	}
+	for _, f := range c.Formats {
+		if f != "jpeg" && f != "webp" {
+			return thumbnailRenditionConfig{}, fmt.Errorf("unsupported format %q", f)
+		}
+	}
+	return c, nil
+}
+
+// storeThumbnail resizes img into every configured rendition and stores them
+// together under a random directory. The largest rendition of the first
+// format is the primary one, whose key and URL are returned alongside the
+// full list. Uploaded and generated thumbnails both go through here.
+func (cfg *apiConfig) storeThumbnail(ctx context.Context, img image.Image) (string, []database.ThumbnailRendition, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	dir := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	var renditions []database.ThumbnailRendition
+	primary := ""
+	widths := thumb.Widths(cfg.thumbnailRenditions.Widths, img.Bounds().Dx())
+	for i, format := range cfg.thumbnailRenditions.Formats {
+		// JPEG has no alpha, so transparent areas would otherwise turn black
+		var background color.Color
+		if format == "jpeg" {
+			background = color.White
+		}
+		for _, width := range widths {
+			resized := thumb.Resize(img, width, background)
+			data, err := thumb.Encode(ctx, resized, format)
+			if err != nil {
+				cfg.deleteStoredObjects(ctx, cfg.thumbnailStorage, dir+"/", true)
+				return "", nil, err
+			}
+			key := fmt.Sprintf("%s/%d.%s", dir, width, format)
+			mediaType := "image/" + format
+			err = cfg.thumbnailStorage.Put(ctx, key, bytes.NewReader(data), mediaType)
+			if err != nil {
+				cfg.deleteStoredObjects(ctx, cfg.thumbnailStorage, dir+"/", true)
+				return "", nil, err
+			}
+			renditions = append(renditions, database.ThumbnailRendition{
+				MediaType: mediaType,
+				Width:     width,
+				Height:    resized.Bounds().Dy(),
+				URL:       cfg.thumbnailStorage.URL(key),
+				Key:       key,
+			})
+			if i == 0 {
+				primary = key
+			}
+		}
+	}
+	return primary, renditions, nil
+}
+
+// generateThumbnail gives videoID a thumbnail taken from filePath unless the
+// user already uploaded one. Failures are logged rather than returned because
+// the video itself is fine without a thumbnail.
+func (cfg *apiConfig) generateThumbnail(ctx context.Context, videoID uuid.UUID, filePath string, meta probe.Metadata) {
+	if cfg.autoThumbnail.Mode == autoThumbnailModeOff {
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		log.Printf("couldn't fetch video %s for thumbnail generation: %v", videoID, err)
+		return
+	}
+	if video.ThumbnailURL != nil && !video.ThumbnailGenerated {
+		return
+	}
+
+	framePath, err := cfg.extractThumbnailFrame(ctx, filePath, meta)
+	if err != nil {
+		log.Printf("couldn't extract thumbnail for video %s: %v", videoID, err)
+		return
+	}
+	defer os.Remove(framePath)
+
+	frame, err := os.ReadFile(framePath)
+	if err != nil {
+		log.Printf("couldn't read thumbnail for video %s: %v", videoID, err)
+		return
+	}
+	img, err := thumb.Decode(frame)
+	if err != nil {
+		log.Printf("couldn't decode thumbnail for video %s: %v", videoID, err)
+		return
+	}
+
+	key, renditions, err := cfg.storeThumbnail(ctx, img)
+	if err != nil {
+		log.Printf("couldn't store thumbnail for video %s: %v", videoID, err)
+		return
+	}
+
+	// The user may have uploaded a thumbnail while we were busy
+	set, err := cfg.db.SetGeneratedThumbnail(videoID, cfg.thumbnailStorage.URL(key), key, renditions)
+	if err != nil {
+		log.Printf("couldn't save thumbnail for video %s: %v", videoID, err)
+	}
+	if err != nil || !set {
+		cfg.deleteStoredObjects(ctx, cfg.thumbnailStorage, path.Dir(key)+"/", true)
+	}
+}
+
+func (cfg *apiConfig) extractThumbnailFrame(ctx context.Context, filePath string, meta probe.Metadata) (string, error) {
+	outPath := filepath.Join(cfg.spoolDir, fmt.Sprintf("thumbnail-%s.%s", uuid.NewString(), cfg.autoThumbnail.Format))
+
+	if cfg.autoThumbnail.Mode == autoThumbnailModeScene {
+		err := runFFmpegFrame(ctx,
+			"-i", filePath,
+			"-vf", fmt.Sprintf("select='gt(scene,%g)'", sceneChangeThreshold),
+			"-vsync", "vfr",
+			"-frames:v", "1",
+			outPath,
+		)
+		if err == nil {
+			return outPath, nil
+		}
+		// Static videos have no scene changes, so fall back to the offset
+	}
+
+	offset := cfg.autoThumbnail.Offset.Seconds()
+	if meta.Duration > 0 && offset >= meta.Duration {
+		offset = meta.Duration / 2
+	}
+	err := runFFmpegFrame(ctx,
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", filePath,
+		"-frames:v", "1",
+		outPath,
+	)
+	if err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
+
+// runFFmpegFrame runs ffmpeg and checks that it actually wrote the frame,
+// since ffmpeg exits cleanly when a filter selects nothing.
+func runFFmpegFrame(ctx context.Context, args ...string) error {
+	outPath := args[len(args)-1]
+	args = append([]string{"-v", "error", "-y"}, args...)
+
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	stat, err := os.Stat(outPath)
+	if err != nil || stat.Size() == 0 {
+		os.Remove(outPath)
+		return errors.New("ffmpeg produced no frame")
+	}
+	return nil
+}
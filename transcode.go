@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/probe"
+	"github.com/google/uuid"
+)
+
+// x264Presets are the presets libx264 accepts, fastest first.
+var x264Presets = []string{
+	"ultrafast", "superfast", "veryfast", "faster", "fast",
+	"medium", "slow", "slower", "veryslow",
+}
+
+func parseTranscodeProfile(crf, preset, maxResolution, audioBitrate string) (database.TranscodeProfile, error) {
+	p := database.TranscodeProfile{
+		CRF:           23,
+		Preset:        "veryfast",
+		MaxResolution: 1080,
+		AudioBitrate:  "128k",
+	}
+	if crf != "" {
+		n, err := strconv.Atoi(crf)
+		if err != nil || n < 0 || n > 51 {
+			return p, fmt.Errorf("invalid CRF %q, must be 0-51", crf)
+		}
+		p.CRF = n
+	}
+	if preset != "" {
+		if !slices.Contains(x264Presets, preset) {
+			return p, fmt.Errorf("unknown preset %q", preset)
+		}
+		p.Preset = preset
+	}
+	if maxResolution != "" {
+		n, err := strconv.Atoi(maxResolution)
+		if err != nil || n < 0 || n%2 != 0 {
+			return p, fmt.Errorf("invalid maximum resolution %q, must be an even number or 0 for no limit", maxResolution)
+		}
+		p.MaxResolution = n
+	}
+	if audioBitrate != "" {
+		n, err := strconv.Atoi(strings.TrimSuffix(audioBitrate, "k"))
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("invalid audio bitrate %q", audioBitrate)
+		}
+		p.AudioBitrate = audioBitrate
+	}
+	return p, nil
+}
+
+// needsTranscode reports whether an upload has to be transcoded before
+// browsers can play it: anything but H.264 with AAC (or no) audio in MP4.
+func needsTranscode(mediaType string, meta probe.Metadata) bool {
+	if mediaType != "video/mp4" || meta.Video == nil || meta.Video.Codec != "h264" {
+		return true
+	}
+	return meta.Audio != nil && meta.Audio.Codec != "aac"
+}
+
+// transcodeVideo converts filePath to an H.264/AAC MP4 in the spool
+// directory using the configured profile, returning the new file's path.
+// Video larger than the profile allows is scaled down, never up.
+func (cfg *apiConfig) transcodeVideo(ctx context.Context, filePath string, meta probe.Metadata) (string, error) {
+	width, height, err := meta.DisplayDimensions()
+	if err != nil {
+		return "", err
+	}
+	p := cfg.transcodeProfile
+	outPath := filepath.Join(cfg.spoolDir, fmt.Sprintf("transcode-%s.mp4", uuid.NewString()))
+
+	args := []string{
+		"-v", "error", "-y",
+		"-i", filePath,
+		"-map", "0:v:0",
+		"-c:v", "libx264",
+		"-preset", p.Preset,
+		"-crf", strconv.Itoa(p.CRF),
+		// Other pixel formats don't play everywhere
+		"-pix_fmt", "yuv420p",
+	}
+	if p.MaxResolution > 0 && min(width, height) > p.MaxResolution {
+		scale := fmt.Sprintf("scale=-2:%d", p.MaxResolution)
+		if height > width {
+			scale = fmt.Sprintf("scale=%d:-2", p.MaxResolution)
+		}
+		args = append(args, "-vf", scale)
+	}
+	if meta.Audio != nil {
+		args = append(args, "-map", "0:a:0", "-c:a", "aac", "-b:a", p.AudioBitrate)
+	}
+	args = append(args, "-f", "mp4", outPath)
+
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return outPath, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/mediacheck"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/probe"
+)
+
+var acceptedThumbnailTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// maxThumbnailUploadSize caps thumbnail upload bodies, form overhead
+// included.
+const maxThumbnailUploadSize = 10 << 20
+
+// videoExtensions lists the containers uploads can come in, which are the
+// ones mediacheck.Sniff recognizes.
+var videoExtensions = map[string]string{
+	"video/mp4":        "mp4",
+	"video/quicktime":  "mov",
+	"video/x-matroska": "mkv",
+	"video/webm":       "webm",
+}
+
+func parseVideoTypes(s string) ([]string, error) {
+	if s == "" {
+		return []string{"video/mp4", "video/quicktime", "video/x-matroska", "video/webm"}, nil
+	}
+	types := splitList(s)
+	for _, t := range types {
+		if _, ok := videoExtensions[t]; !ok {
+			return nil, fmt.Errorf("unsupported type %q", t)
+		}
+	}
+	return types, nil
+}
+
+// videoTypeForKey recovers the media type of an uploaded object from the
+// extension its key was given.
+func videoTypeForKey(key string) string {
+	ext := strings.TrimPrefix(path.Ext(key), ".")
+	for mediaType, e := range videoExtensions {
+		if e == ext {
+			return mediaType
+		}
+	}
+	return ""
+}
+
+func parseVideoLimits(maxDuration, videoCodecs, audioCodecs string) (mediacheck.VideoLimits, error) {
+	// Anything but H.264/AAC is transcoded, so these only need to be codecs
+	// ffmpeg decodes well
+	limits := mediacheck.VideoLimits{
+		MaxDuration: 4 * time.Hour,
+		VideoCodecs: []string{"h264", "hevc", "av1", "vp9", "vp8", "mpeg4", "prores"},
+		AudioCodecs: []string{"aac", "mp3", "opus", "vorbis", "flac", "ac3", "eac3", "pcm_s16le", "pcm_s24le"},
+	}
+	if maxDuration != "" {
+		d, err := time.ParseDuration(maxDuration)
+		if err != nil || d <= 0 {
+			return limits, fmt.Errorf("invalid maximum duration %q", maxDuration)
+		}
+		limits.MaxDuration = d
+	}
+	if videoCodecs != "" {
+		limits.VideoCodecs = splitList(videoCodecs)
+	}
+	if audioCodecs != "" {
+		limits.AudioCodecs = splitList(audioCodecs)
+	}
+	return limits, nil
+}
+
+func parseImageLimits(maxDimension, maxPixels string) (mediacheck.ImageLimits, error) {
+	limits := mediacheck.ImageLimits{
+		MaxWidth:  4096,
+		MaxHeight: 4096,
+		MaxPixels: 16_000_000,
+	}
+	if maxDimension != "" {
+		n, err := strconv.Atoi(maxDimension)
+		if err != nil || n <= 0 {
+			return limits, fmt.Errorf("invalid maximum dimension %q", maxDimension)
+		}
+		limits.MaxWidth, limits.MaxHeight = n, n
+	}
+	if maxPixels != "" {
+		n, err := strconv.Atoi(maxPixels)
+		if err != nil || n <= 0 {
+			return limits, fmt.Errorf("invalid maximum pixel count %q", maxPixels)
+		}
+		limits.MaxPixels = n
+	}
+	return limits, nil
+}
+
+// splitList parses a comma-separated setting, ignoring empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// checkVideoType sniffs a spooled upload and checks that it's one of the
+// accepted types, returning the type found.
+func (cfg *apiConfig) checkVideoType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head, err := mediacheck.ReadHead(f)
+	if err != nil {
+		return "", err
+	}
+	return mediacheck.CheckType(head, "", cfg.videoTypes)
+}
+
+// checkVideoFile runs ffprobe over a spooled upload and checks it against the
+// configured limits. Files ffprobe can't make sense of are rejected too.
+func (cfg *apiConfig) checkVideoFile(ctx context.Context, path string) (probe.Metadata, error) {
+	meta, err := probe.Probe(ctx, path)
+	if errors.Is(err, exec.ErrNotFound) || ctx.Err() != nil {
+		return meta, err
+	}
+	if err != nil {
+		return meta, &mediacheck.Rejection{
+			Code:    "unreadable_media",
+			Message: "Couldn't read the file as a video",
+		}
+	}
+	return meta, mediacheck.CheckVideo(meta, cfg.videoLimits)
+}
+
+// respondWithRejection answers with the details of a failed media check,
+// reporting whether err was one.
+func respondWithRejection(w http.ResponseWriter, err error) bool {
+	var rejection *mediacheck.Rejection
+	if !errors.As(err, &rejection) {
+		return false
+	}
+	code := http.StatusUnprocessableEntity
+	if rejection.Unsupported {
+		code = http.StatusUnsupportedMediaType
+	}
+	respondWithJSON(w, code, rejection)
+	return true
+}
+
+// uploadFormMaxMemory is how much of a multipart form is kept in memory; the
+// rest goes to temporary files.
+const uploadFormMaxMemory = 32 << 20
+
+// parseUploadForm caps the request body at maxSize and parses it as a
+// multipart form, answering with 413 when the body is too large and 400 when
+// it isn't a form. It reports whether the form was parsed.
+func parseUploadForm(w http.ResponseWriter, r *http.Request, maxSize int64) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	err := r.ParseMultipartForm(uploadFormMaxMemory)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload is larger than %d bytes", maxSize), err)
+		return false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse multipart form", err)
+		return false
+	}
+	return true
+}
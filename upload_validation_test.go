@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func multipartBody(t *testing.T, field string, size int) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile(field, "upload.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(bytes.Repeat([]byte("x"), size))
+	mw.Close()
+	return &body, mw.FormDataContentType()
+}
+
+func TestParseUploadForm(t *testing.T) {
+	small, smallType := multipartBody(t, "video", 100)
+	large, largeType := multipartBody(t, "video", 2000)
+	tests := []struct {
+		name        string
+		body        *bytes.Buffer
+		contentType string
+		wantOK      bool
+		wantCode    int
+	}{
+		{"within limit", small, smallType, true, http.StatusOK},
+		{"too large", large, largeType, false, http.StatusRequestEntityTooLarge},
+		{"not multipart", bytes.NewBufferString(`{"title":"x"}`), "application/json", false, http.StatusBadRequest},
+		{"truncated form", bytes.NewBufferString(strings.Repeat("x", 50)), smallType, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/video_upload/x", tt.body)
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			ok := parseUploadForm(w, r, 1000)
+			if ok != tt.wantOK || w.Code != tt.wantCode {
+				t.Errorf("parseUploadForm() = %v with status %d, want %v with %d", ok, w.Code, tt.wantOK, tt.wantCode)
+			}
+		})
+	}
+}
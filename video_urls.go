@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// applyVideoVisibility recomputes the stored URLs from the stored keys. Public
+// and unlisted videos keep permanent URLs; private videos keep only keys, for
+// the video and its thumbnail alike.
+func (cfg *apiConfig) applyVideoVisibility(video *database.Video) {
+	private := video.Visibility == database.VisibilityPrivate
+	if video.VideoKey != nil {
+		video.VideoURL = nil
+		if !private {
+			u := cfg.videoStorage.URL(*video.VideoKey)
+			video.VideoURL = &u
+		}
+	}
+	if video.HLSKey != nil {
+		video.HLSURL = nil
+		if !private {
+			u := cfg.videoStorage.URL(*video.HLSKey)
+			video.HLSURL = &u
+		}
+	}
+	if video.ThumbnailKey != nil {
+		video.ThumbnailURL = nil
+		if !private {
+			u := cfg.thumbnailStorage.URL(*video.ThumbnailKey)
+			video.ThumbnailURL = &u
+		}
+	}
+	renditions := make([]database.ThumbnailRendition, len(video.ThumbnailRenditions))
+	for i, r := range video.ThumbnailRenditions {
+		r.URL = ""
+		if !private {
+			r.URL = cfg.thumbnailStorage.URL(r.Key)
+		}
+		renditions[i] = r
+	}
+	video.ThumbnailRenditions = renditions
+	video.Thumbnails = database.ThumbnailSets(renditions)
+}
+
+// rotateVideoKeys copies a video's MP4, HLS tree and thumbnail renditions to
+// fresh random keys and returns the video pointing at the copies, along with
+// a function that deletes them should saving the video fail. Going private has
+// to move the objects: URLs handed out while the video was public name the
+// old keys, and CloudFront keeps serving those until the objects are gone.
+// Saving the new keys tombstones the old ones.
+func (cfg *apiConfig) rotateVideoKeys(ctx context.Context, video database.Video) (database.Video, func(), error) {
+	var copies []func()
+	discard := func() {
+		for _, del := range copies {
+			del()
+		}
+	}
+
+	if video.VideoKey != nil {
+		videoKey, hlsKey, err := cfg.copyVideoObjects(ctx, video)
+		if err != nil {
+			return video, nil, err
+		}
+		copies = append(copies, func() {
+			cfg.deleteStoredObjects(context.Background(), cfg.videoStorage, *videoKey, false)
+		})
+		if hlsKey != nil {
+			copies = append(copies, func() {
+				cfg.deleteStoredObjects(context.Background(), cfg.videoStorage, path.Dir(*hlsKey)+"/", true)
+			})
+		}
+		video.VideoKey, video.HLSKey = videoKey, hlsKey
+	}
+
+	if video.ThumbnailKey != nil {
+		thumbnailKey, renditions, err := cfg.copyThumbnailObjects(ctx, video)
+		if err != nil {
+			discard()
+			return video, nil, err
+		}
+		copies = append(copies, func() {
+			cfg.deleteStoredObjects(context.Background(), cfg.thumbnailStorage, path.Dir(thumbnailKey)+"/", true)
+		})
+		video.ThumbnailKey, video.ThumbnailRenditions = &thumbnailKey, renditions
+	}
+	return video, discard, nil
+}
+
+func randomKeyName() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+func (cfg *apiConfig) copyVideoObjects(ctx context.Context, video database.Video) (videoKey, hlsKey *string, err error) {
+	name, err := randomKeyName()
+	if err != nil {
+		return nil, nil, err
+	}
+	oldKey := *video.VideoKey
+	newKey := path.Join(path.Dir(oldKey), name+path.Ext(oldKey))
+	err = copyStoredObject(ctx, cfg.videoStorage, oldKey, newKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't copy video: %w", err)
+	}
+	if video.HLSKey == nil {
+		return &newKey, nil, nil
+	}
+
+	oldPrefix := path.Dir(*video.HLSKey) + "/"
+	newPrefix := hlsKeyPrefix(newKey) + "/"
+	objects, err := cfg.videoStorage.List(ctx, oldPrefix)
+	if err == nil {
+		for _, obj := range objects {
+			err = copyStoredObject(ctx, cfg.videoStorage, obj.Key, newPrefix+strings.TrimPrefix(obj.Key, oldPrefix))
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		cfg.deleteStoredObjects(context.Background(), cfg.videoStorage, newKey, false)
+		cfg.deleteStoredObjects(context.Background(), cfg.videoStorage, newPrefix, true)
+		return nil, nil, fmt.Errorf("couldn't copy HLS files: %w", err)
+	}
+	newHLSKey := newPrefix + path.Base(*video.HLSKey)
+	return &newKey, &newHLSKey, nil
+}
+
+// copyThumbnailObjects copies a thumbnail's renditions into a new random
+// directory, the layout storeThumbnail uses. Thumbnails stored before
+// renditions existed are a single object and move into a directory too.
+func (cfg *apiConfig) copyThumbnailObjects(ctx context.Context, video database.Video) (string, []database.ThumbnailRendition, error) {
+	dir, err := randomKeyName()
+	if err != nil {
+		return "", nil, err
+	}
+	keys := []string{*video.ThumbnailKey}
+	if len(video.ThumbnailRenditions) > 0 {
+		keys = keys[:0]
+		for _, r := range video.ThumbnailRenditions {
+			keys = append(keys, r.Key)
+		}
+	}
+	for _, key := range keys {
+		err = copyStoredObject(ctx, cfg.thumbnailStorage, key, dir+"/"+path.Base(key))
+		if err != nil {
+			cfg.deleteStoredObjects(context.Background(), cfg.thumbnailStorage, dir+"/", true)
+			return "", nil, fmt.Errorf("couldn't copy thumbnail: %w", err)
+		}
+	}
+
+	renditions := make([]database.ThumbnailRendition, len(video.ThumbnailRenditions))
+	for i, r := range video.ThumbnailRenditions {
+		r.Key = dir + "/" + path.Base(r.Key)
+		renditions[i] = r
+	}
+	return dir + "/" + path.Base(*video.ThumbnailKey), renditions, nil
+}
+
+// copyStoredObject copies srcKey to dstKey within st, without downloading it
+// when the backend can copy on its own.
+func copyStoredObject(ctx context.Context, st storage.Storage, srcKey, dstKey string) error {
+	if copier, ok := st.(storage.Copier); ok {
+		return copier.Copy(ctx, srcKey, dstKey)
+	}
+	body, info, err := st.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return st.Put(ctx, dstKey, body, info.ContentType)
+}
+
+// resolveVideoURLs fills in short-lived URLs for private videos and their
+// thumbnails. The result is for responses only and must never be saved back
+// to the database.
+//
+// With a CloudFront key pair the video URL is signed for the distribution and
+// the HLS URL is left unsigned; players fetch signed cookies from
+// handlerCDNCookies to authorize the playlist and its segments. Without one,
+// HLS stays unavailable because a presigned playlist can't authorize the
+// segment requests it leads to. Backends that can't restrict access give
+// private videos no URLs at all.
+func (cfg *apiConfig) resolveVideoURLs(ctx context.Context, video database.Video) database.Video {
+	if video.Visibility != database.VisibilityPrivate {
+		return video
+	}
+
+	if video.VideoKey != nil {
+		video.VideoURL, video.HLSURL = nil, nil
+		u, err := cfg.signedObjectURL(ctx, cfg.videoStorage, *video.VideoKey)
+		if err != nil {
+			log.Printf("couldn't sign video %s: %v", video.ID, err)
+		} else if u != "" {
+			video.VideoURL = &u
+			if cfg.cdnSigner != nil && video.HLSKey != nil {
+				hlsURL := cfg.videoStorage.URL(*video.HLSKey)
+				video.HLSURL = &hlsURL
+			}
+		}
+	}
+
+	if video.ThumbnailKey != nil {
+		video.ThumbnailURL = nil
+		video.Thumbnails = map[string]database.ThumbnailSet{}
+		u, err := cfg.signedObjectURL(ctx, cfg.thumbnailStorage, *video.ThumbnailKey)
+		if err != nil || u == "" {
+			if err != nil {
+				log.Printf("couldn't sign thumbnail of video %s: %v", video.ID, err)
+			}
+			return video
+		}
+		video.ThumbnailURL = &u
+
+		renditions := make([]database.ThumbnailRendition, len(video.ThumbnailRenditions))
+		for i, r := range video.ThumbnailRenditions {
+			r.URL, err = cfg.signedObjectURL(ctx, cfg.thumbnailStorage, r.Key)
+			if err != nil {
+				log.Printf("couldn't sign thumbnail of video %s: %v", video.ID, err)
+				return video
+			}
+			renditions[i] = r
+		}
+		video.ThumbnailRenditions = renditions
+		video.Thumbnails = database.ThumbnailSets(renditions)
+	}
+	return video
+}
+
+// signedObjectURL returns a short-lived URL for key in st, or an empty string
+// when st can't restrict access. Only presigning backends sit behind the
+// CloudFront distribution, so only they get CloudFront-signed URLs.
+func (cfg *apiConfig) signedObjectURL(ctx context.Context, st storage.Storage, key string) (string, error) {
+	presigner, ok := st.(storage.Presigner)
+	if !ok {
+		return "", nil
+	}
+	if cfg.cdnSigner != nil {
+		return cfg.cdnSigner.SignURL(st.URL(key), time.Now().Add(cfg.videoURLExpiry))
+	}
+	return presigner.PresignGet(ctx, key, cfg.videoURLExpiry)
+}
+
+// canViewVideo reports whether the request may see video. Public and unlisted
+// videos are open to anyone; private ones need a JWT or API key from the owner.
+func (cfg *apiConfig) canViewVideo(r *http.Request, video database.Video) bool {
+	if video.Visibility != database.VisibilityPrivate {
+		return true
+	}
+	return userIDFromContext(r.Context()) == video.UserID
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func newTestConfig(t *testing.T) *apiConfig {
+	t.Helper()
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &apiConfig{
+		db:               db,
+		videoStorage:     storage.NewMemoryStorage("memory://videos"),
+		thumbnailStorage: storage.NewMemoryStorage("memory://thumbnails"),
+	}
+}
+
+func putTestObject(t *testing.T, st storage.Storage, key, body string) {
+	t.Helper()
+	err := st.Put(context.Background(), key, strings.NewReader(body), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateVideoKeysRetiresPublicObjects(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+	user, err := cfg.db.CreateUser(database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err := cfg.db.CreateVideo(database.CreateVideoParams{Title: "Title", Visibility: database.VisibilityPublic, UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putTestObject(t, cfg.videoStorage, "landscape/abc.mp4", "mp4")
+	putTestObject(t, cfg.videoStorage, "landscape/abc/hls/master.m3u8", "master")
+	putTestObject(t, cfg.videoStorage, "landscape/abc/hls/720p/segment0.ts", "segment")
+	putTestObject(t, cfg.thumbnailStorage, "thumbs/640.jpeg", "large")
+	putTestObject(t, cfg.thumbnailStorage, "thumbs/320.jpeg", "small")
+	videoKey, hlsKey, thumbnailKey := "landscape/abc.mp4", "landscape/abc/hls/master.m3u8", "thumbs/640.jpeg"
+	video.VideoKey, video.HLSKey, video.ThumbnailKey = &videoKey, &hlsKey, &thumbnailKey
+	video.ThumbnailRenditions = []database.ThumbnailRendition{
+		{MediaType: "image/jpeg", Width: 320, Height: 180, Key: "thumbs/320.jpeg"},
+		{MediaType: "image/jpeg", Width: 640, Height: 360, Key: "thumbs/640.jpeg"},
+	}
+	cfg.applyVideoVisibility(&video)
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, discard, err := cfg.rotateVideoKeys(ctx, video)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discard == nil {
+		t.Fatal("no function to discard the copies")
+	}
+	newVideoKey, newHLSKey := rotated.VideoKey, rotated.HLSKey
+	if newVideoKey == nil || *newVideoKey == videoKey || !strings.HasPrefix(*newVideoKey, "landscape/") {
+		t.Fatalf("new video key = %v", newVideoKey)
+	}
+	if newHLSKey == nil || *newHLSKey != hlsKeyPrefix(*newVideoKey)+"/master.m3u8" {
+		t.Fatalf("new HLS key = %v, want the master playlist beside %s", newHLSKey, *newVideoKey)
+	}
+	segment := hlsKeyPrefix(*newVideoKey) + "/720p/segment0.ts"
+	body, _, err := cfg.videoStorage.Get(ctx, segment)
+	if err != nil {
+		t.Fatalf("segment wasn't copied: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "segment" {
+		t.Errorf("copied segment holds %q", data)
+	}
+	newThumbnailDir := path.Dir(*rotated.ThumbnailKey)
+	if newThumbnailDir == "thumbs" || path.Base(*rotated.ThumbnailKey) != "640.jpeg" {
+		t.Fatalf("new thumbnail key = %s", *rotated.ThumbnailKey)
+	}
+	for _, r := range rotated.ThumbnailRenditions {
+		if path.Dir(r.Key) != newThumbnailDir {
+			t.Errorf("rendition %s wasn't moved to %s", r.Key, newThumbnailDir)
+		}
+		_, err := cfg.thumbnailStorage.Stat(ctx, r.Key)
+		if err != nil {
+			t.Errorf("rendition %s wasn't copied: %v", r.Key, err)
+		}
+	}
+
+	video = rotated
+	video.Visibility = database.VisibilityPrivate
+	cfg.applyVideoVisibility(&video)
+	if video.VideoURL != nil || video.ThumbnailURL != nil {
+		t.Errorf("private video keeps URLs %v and %v", video.VideoURL, video.ThumbnailURL)
+	}
+	err = cfg.db.UpdateVideoIfVersion(video, video.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sweeping the old keys' tombstones leaves nothing at the public URLs
+	tombstones, err := cfg.db.GetDueTombstones(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range tombstones {
+		err := cfg.purgeTombstone(ctx, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{videoKey, hlsKey, "landscape/abc/hls/720p/segment0.ts"} {
+		_, err := cfg.videoStorage.Stat(ctx, key)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s still exists after sweeping: %v", key, err)
+		}
+	}
+	for _, key := range []string{"thumbs/640.jpeg", "thumbs/320.jpeg"} {
+		_, err := cfg.thumbnailStorage.Stat(ctx, key)
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s still exists after sweeping: %v", key, err)
+		}
+	}
+	_, err = cfg.videoStorage.Stat(ctx, *newVideoKey)
+	if err != nil {
+		t.Errorf("new video object is gone: %v", err)
+	}
+}
+
+func TestResolveVideoURLsWithoutAccessControl(t *testing.T) {
+	cfg := newTestConfig(t)
+	videoKey, thumbnailKey := "landscape/abc.mp4", "thumbs/640.jpeg"
+	video := database.Video{
+		VideoKey:     &videoKey,
+		ThumbnailKey: &thumbnailKey,
+		ThumbnailRenditions: []database.ThumbnailRendition{
+			{MediaType: "image/jpeg", Width: 640, Height: 360, Key: thumbnailKey},
+		},
+		CreateVideoParams: database.CreateVideoParams{Visibility: database.VisibilityPublic},
+	}
+	cfg.applyVideoVisibility(&video)
+
+	// A stale public URL left on a private row must not leak either
+	video.Visibility = database.VisibilityPrivate
+	resolved := cfg.resolveVideoURLs(context.Background(), video)
+	if resolved.VideoURL != nil || resolved.HLSURL != nil {
+		t.Errorf("private video got URLs %v and %v from a backend without access control", resolved.VideoURL, resolved.HLSURL)
+	}
+	if resolved.ThumbnailURL != nil || len(resolved.Thumbnails) != 0 {
+		t.Errorf("private thumbnail got URLs %v and %v", resolved.ThumbnailURL, resolved.Thumbnails)
+	}
+
+	video.Visibility = database.VisibilityPublic
+	resolved = cfg.resolveVideoURLs(context.Background(), video)
+	if resolved.VideoURL == nil || *resolved.VideoURL != cfg.videoStorage.URL(videoKey) {
+		t.Errorf("public video URL = %v", resolved.VideoURL)
+	}
+	if resolved.Thumbnails["image/jpeg"].Srcset != cfg.thumbnailStorage.URL(thumbnailKey)+" 640w" {
+		t.Errorf("public thumbnails = %+v", resolved.Thumbnails)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	jobLeaseDuration = 2 * time.Minute
+	jobPollInterval  = 2 * time.Second
+	jobBaseBackoff   = 10 * time.Second
+	jobMaxBackoff    = 30 * time.Minute
+)
+
+// jobHandler runs a single job. Long-running handlers should call progress
+// periodically; it also keeps the job's lease alive.
+type jobHandler func(ctx context.Context, job database.Job, progress func(int)) error
+
+// permanentError marks a job failure that retrying can't fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func (cfg *apiConfig) jobHandlers() map[string]jobHandler {
+	return map[string]jobHandler{
+		jobTypeProcessVideo: cfg.handleProcessVideoJob,
+	}
+}
+
+// startWorkers launches n workers that poll the jobs table until ctx is done.
+// The returned WaitGroup completes once every worker has stopped.
+func (cfg *apiConfig) startWorkers(ctx context.Context, n int) *sync.WaitGroup {
+	handlers := cfg.jobHandlers()
+	hostname, _ := os.Hostname()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		workerID := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg.runWorker(ctx, workerID, handlers)
+		}()
+	}
+	return wg
+}
+
+func (cfg *apiConfig) runWorker(ctx context.Context, workerID string, handlers map[string]jobHandler) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before going back to sleep
+		for ctx.Err() == nil {
+			job, err := cfg.db.LeaseJob(workerID, jobLeaseDuration)
+			if err != nil {
+				log.Printf("worker %s: couldn't lease job: %v", workerID, err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			cfg.runJob(ctx, workerID, *job, handlers)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) runJob(ctx context.Context, workerID string, job database.Job, handlers map[string]jobHandler) {
+	handler, ok := handlers[job.Type]
+	if !ok {
+		err := cfg.db.FailJob(job.ID, workerID, fmt.Sprintf("unknown job type %q", job.Type), 0, false)
+		if err != nil {
+			log.Printf("worker %s: couldn't fail job %s: %v", workerID, job.ID, err)
+		}
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	progress := job.Progress
+	heartbeat := func() {
+		mu.Lock()
+		p := progress
+		mu.Unlock()
+		err := cfg.db.HeartbeatJob(job.ID, workerID, jobLeaseDuration, p)
+		if errors.Is(err, database.ErrJobLeaseLost) {
+			// Someone else owns the job now, so stop working on it
+			cancel()
+		} else if err != nil {
+			log.Printf("worker %s: heartbeat for job %s failed: %v", workerID, job.ID, err)
+		}
+	}
+	report := func(p int) {
+		mu.Lock()
+		progress = p
+		mu.Unlock()
+		heartbeat()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobLeaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				heartbeat()
+			}
+		}
+	}()
+
+	log.Printf("worker %s: running %s job %s (attempt %d/%d)", workerID, job.Type, job.ID, job.Attempts, job.MaxAttempts)
+	err := handler(jobCtx, job, report)
+	close(done)
+
+	switch {
+	case err == nil:
+		err = cfg.db.CompleteJob(job.ID, workerID)
+	case ctx.Err() != nil:
+		// Shutting down, not a real failure
+		err = cfg.db.ReleaseJob(job.ID, workerID)
+	default:
+		log.Printf("worker %s: job %s failed: %v", workerID, job.ID, err)
+		var perm permanentError
+		retry := !errors.As(err, &perm)
+		err = cfg.db.FailJob(job.ID, workerID, err.Error(), jobBackoff(job.Attempts), retry)
+	}
+	if err != nil && !errors.Is(err, database.ErrJobLeaseLost) {
+		log.Printf("worker %s: couldn't record result of job %s: %v", workerID, job.ID, err)
+	}
+}
+
+// jobBackoff doubles the delay for every attempt, capped at jobMaxBackoff.
+func jobBackoff(attempts int) time.Duration {
+	backoff := jobBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= jobMaxBackoff {
+			return jobMaxBackoff
+		}
+	}
+	return backoff
+}